@@ -0,0 +1,292 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/jade-guiton/telui/server"
+	"gopkg.in/yaml.v3"
+)
+
+type expectation struct {
+	Name       string         `yaml:"name"`
+	Attributes map[string]any `yaml:"attributes"`
+	Resource   map[string]any `yaml:"resource"`
+	Status     string         `yaml:"status"`   // spans only
+	Severity   string         `yaml:"severity"` // logs only
+	Body       string         `yaml:"body"`     // logs only, substring of the body
+	Value      *float64       `yaml:"value"`    // metrics only, last value
+	Count      *int           `yaml:"count"`
+	Min        *int           `yaml:"min"`
+	Max        *int           `yaml:"max"`
+}
+
+type expectFile struct {
+	Timeout time.Duration `yaml:"timeout"`
+	Spans   []expectation `yaml:"spans"`
+	Logs    []expectation `yaml:"logs"`
+	Metrics []expectation `yaml:"metrics"`
+}
+
+// YAML being a superset of JSON, this reads both
+func readExpectFile(path string) (expectFile, error) {
+	var ef expectFile
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ef, err
+	}
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&ef); err != nil {
+		return ef, fmt.Errorf("invalid expectation file %s: %w", path, err)
+	}
+	for _, e := range ef.Metrics {
+		if e.Name == "" {
+			return ef, fmt.Errorf("invalid expectation file %s: metric expectations need a name", path)
+		}
+	}
+	return ef, nil
+}
+
+func (e expectation) bounds() (int, int) {
+	lo, hi := 1, -1
+	if e.Count != nil {
+		lo, hi = *e.Count, *e.Count
+	}
+	if e.Min != nil {
+		lo = *e.Min
+	}
+	if e.Max != nil {
+		hi = *e.Max
+		if e.Count == nil && e.Min == nil {
+			lo = 0
+		}
+	}
+	return lo, hi
+}
+
+func (e expectation) matchers(signal string) []server.Matcher {
+	var ms []server.Matcher
+	if e.Name != "" && signal != "metric" {
+		ms = append(ms, server.Named(e.Name))
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Attributes)) {
+		ms = append(ms, server.Attr(k, e.Attributes[k]))
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Resource)) {
+		ms = append(ms, server.ResourceAttr(k, e.Resource[k]))
+	}
+	if e.Status != "" {
+		ms = append(ms, server.Status(e.Status))
+	}
+	if e.Severity != "" {
+		ms = append(ms, server.Severity(e.Severity))
+	}
+	if e.Body != "" {
+		ms = append(ms, server.BodyContains(e.Body))
+	}
+	return ms
+}
+
+func (e expectation) describe(signal string) string {
+	parts := []string{signal}
+	if e.Name != "" {
+		parts = append(parts, fmt.Sprintf("%q", e.Name))
+	}
+	if e.Severity != "" {
+		parts = append(parts, "severity="+e.Severity)
+	}
+	if e.Status != "" {
+		parts = append(parts, "status="+e.Status)
+	}
+	if e.Body != "" {
+		parts = append(parts, fmt.Sprintf("body~%q", e.Body))
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Attributes)) {
+		parts = append(parts, fmt.Sprintf("%s=%v", k, e.Attributes[k]))
+	}
+	for _, k := range slices.Sorted(maps.Keys(e.Resource)) {
+		parts = append(parts, fmt.Sprintf("resource.%s=%v", k, e.Resource[k]))
+	}
+	if e.Value != nil {
+		parts = append(parts, fmt.Sprintf("value=%g", *e.Value))
+	}
+	return strings.Join(parts, " ")
+}
+
+type expectResult struct {
+	desc  string
+	found int
+	lo    int
+	hi    int
+	ok    bool
+	notes []string // why the closest candidates did not match
+}
+
+func (r expectResult) want() string {
+	switch {
+	case r.lo == r.hi:
+		return fmt.Sprintf("exactly %d", r.lo)
+	case r.hi < 0:
+		return fmt.Sprintf("at least %d", r.lo)
+	case r.lo == 0:
+		return fmt.Sprintf("at most %d", r.hi)
+	default:
+		return fmt.Sprintf("between %d and %d", r.lo, r.hi)
+	}
+}
+
+const maxExpectNotes = 3
+
+// Explains which attributes of a candidate with the right name differ from the expectation
+func attrDiff(prefix string, want map[string]any, got map[string]any) []string {
+	var diffs []string
+	for _, k := range slices.Sorted(maps.Keys(want)) {
+		v, ok := got[k]
+		if !ok {
+			diffs = append(diffs, fmt.Sprintf("%s%s missing", prefix, k))
+		} else if !server.AttrEqual(v, want[k]) {
+			diffs = append(diffs, fmt.Sprintf("%s%s=%v (%s)", prefix, k, v, reflect.TypeOf(v)))
+		}
+	}
+	return diffs
+}
+
+func checkExpectation(h *server.Receiver, signal string, e expectation) expectResult {
+	r := expectResult{desc: e.describe(signal)}
+	r.lo, r.hi = e.bounds()
+	ms := e.matchers(signal)
+	note := func(diffs []string) {
+		if len(diffs) > 0 && len(r.notes) < maxExpectNotes {
+			r.notes = append(r.notes, strings.Join(diffs, ", "))
+		}
+	}
+	switch signal {
+	case "span":
+		r.found = len(h.Spans(ms...))
+		if r.found < r.lo && e.Name != "" {
+			for _, s := range h.Spans(server.Named(e.Name)) {
+				diffs := attrDiff("", e.Attributes, s.Attributes)
+				diffs = append(diffs, attrDiff("resource.", e.Resource, s.Resource)...)
+				if e.Status != "" && s.Status != e.Status {
+					diffs = append(diffs, fmt.Sprintf("status=%q", s.Status))
+				}
+				note(diffs)
+			}
+		}
+	case "log":
+		r.found = h.CountLogs(ms...)
+	case "metric":
+		points := h.MetricPoints(e.Name, ms...)
+		r.found = len(points)
+		if e.Value != nil && len(points) > 0 {
+			if last := points[len(points)-1].Value; last != *e.Value {
+				note([]string{fmt.Sprintf("last value=%g", last)})
+				r.found = 0
+			}
+		}
+		if len(points) == 0 {
+			for _, mp := range h.MetricPoints(e.Name) {
+				diffs := attrDiff("", e.Attributes, mp.Attributes)
+				note(append(diffs, attrDiff("resource.", e.Resource, mp.Resource)...))
+			}
+		}
+	}
+	r.ok = r.found >= r.lo && (r.hi < 0 || r.found <= r.hi)
+	return r
+}
+
+func checkExpectations(h *server.Receiver, ef expectFile) ([]expectResult, bool) {
+	var results []expectResult
+	ok := true
+	for _, group := range []struct {
+		signal string
+		exps   []expectation
+	}{{"span", ef.Spans}, {"log", ef.Logs}, {"metric", ef.Metrics}} {
+		for _, e := range group.exps {
+			r := checkExpectation(h, group.signal, e)
+			ok = ok && r.ok
+			results = append(results, r)
+		}
+	}
+	return results, ok
+}
+
+func printExpectResults(results []expectResult) {
+	for _, r := range results {
+		mark := "+"
+		if !r.ok {
+			mark = "-"
+		}
+		fmt.Printf("%s %s: found %d, want %s\n", mark, r.desc, r.found, r.want())
+		for _, n := range r.notes {
+			fmt.Printf("      closest: %s\n", n)
+		}
+	}
+}
+
+// Exit codes: 0 if all expectations are met, 1 if not, 2 on usage errors
+func runExpect(args []string) int {
+	fs := flag.NewFlagSet("telui expect", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: telui expect [flags] <expectations.yaml|json>\n")
+		fs.PrintDefaults()
+	}
+	grpcPort := fs.Int("grpc", 4317, "Port for OTLP/gRPC server")
+	httpPort := fs.Int("http", 4318, "Port for OTLP/HTTP server")
+	timeout := fs.Duration("timeout", 0, "How long to wait for the expectations (default: from the file, or 30s)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+
+	ef, err := readExpectFile(fs.Arg(0))
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if *timeout == 0 {
+		*timeout = ef.Timeout
+	}
+	if *timeout == 0 {
+		*timeout = 30 * time.Second
+	}
+
+	cfg := server.DefaultConfig()
+	cfg.GrpcPort, cfg.HttpPort = *grpcPort, *httpPort
+	h, err := server.StartReceiver(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start receivers: %v\n", err)
+		return 2
+	}
+	defer h.Stop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), *timeout)
+	defer cancel()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		results, ok := checkExpectations(h, ef)
+		if ok {
+			printExpectResults(results)
+			fmt.Println("All expectations met.")
+			return 0
+		}
+		select {
+		case <-ctx.Done():
+			fmt.Printf("Expectations not met after %v:\n", *timeout)
+			printExpectResults(results)
+			return 1
+		case <-ticker.C:
+		}
+	}
+}
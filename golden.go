@@ -0,0 +1,83 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+	"time"
+
+	"github.com/jade-guiton/telui/server"
+)
+
+// Exit codes: 0 if the telemetry matches the golden file, 1 if not, 2 on usage errors
+func runGolden(args []string) int {
+	fs := flag.NewFlagSet("telui golden", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: telui golden [flags] <golden.json>\n")
+		fs.PrintDefaults()
+	}
+	grpcPort := fs.Int("grpc", 4317, "Port for OTLP/gRPC server")
+	httpPort := fs.Int("http", 4318, "Port for OTLP/HTTP server")
+	update := fs.Bool("update", false, "Write the received telemetry to the golden file instead of comparing")
+	idle := fs.Duration("idle", 2*time.Second, "Stop receiving once telemetry has stopped changing for this long")
+	timeout := fs.Duration("timeout", 30*time.Second, "Stop receiving after this long in any case")
+	ignore := fs.String("ignore-attr", "", "Comma-separated attribute keys to leave out of the comparison (eg. process.pid,host.name)")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		fs.Usage()
+		return 2
+	}
+	var ignoreAttrs []string
+	if *ignore != "" {
+		ignoreAttrs = strings.Split(*ignore, ",")
+	}
+
+	cfg := server.DefaultConfig()
+	cfg.GrpcPort, cfg.HttpPort = *grpcPort, *httpPort
+	h, err := server.StartReceiver(cfg)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start receivers: %v\n", err)
+		return 2
+	}
+	defer h.Stop()
+
+	empty := h.Snapshot(ignoreAttrs...)
+	last := empty
+	lastChange := time.Now()
+	deadline := time.After(*timeout)
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt)
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+wait:
+	for {
+		select {
+		case <-ticker.C:
+			snapshot := h.Snapshot(ignoreAttrs...)
+			if !bytes.Equal(snapshot, last) {
+				last = snapshot
+				lastChange = time.Now()
+			} else if !bytes.Equal(last, empty) && time.Since(lastChange) >= *idle {
+				break wait
+			}
+		case <-deadline:
+			break wait
+		case <-interrupt:
+			break wait
+		}
+	}
+
+	if err := h.CompareGolden(fs.Arg(0), *update, ignoreAttrs...); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	if *update {
+		fmt.Printf("Wrote %s\n", fs.Arg(0))
+	} else {
+		fmt.Println("Telemetry matches the golden file.")
+	}
+	return 0
+}
@@ -3,59 +3,148 @@ package main
 import (
 	"flag"
 	"fmt"
+	"maps"
 	"os"
-	"os/signal"
+	"reflect"
+	"strings"
+
+	"github.com/jade-guiton/telui/server"
 )
 
-type stopFunc func()
+type headerFlags map[string]string
 
-func (s stopFunc) stop() {
-	if s != nil {
-		s()
+func (hf headerFlags) String() string {
+	var parts []string
+	for k, v := range hf {
+		parts = append(parts, k+"="+v)
 	}
+	return strings.Join(parts, ",")
 }
 
-func start() error {
-	grpcPort := flag.Int("grpc", 4317, "Port for OTLP/gRPC server (0 to disable)")
-	httpPort := flag.Int("http", 4318, "Port for OTLP/HTTP server (0 to disable)")
-	uiPort := flag.Int("ui", 8080, "Port for web interface")
-	verbose := flag.Bool("verbose", false, "Log incoming data")
+func (hf headerFlags) Set(s string) error {
+	k, v, ok := strings.Cut(s, "=")
+	if !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	hf[k] = v
+	return nil
+}
 
-	flag.Parse()
+// The Config field set by each flag, to apply the flags given explicitly on
+// top of the config file
+var flagFields = map[string]string{
+	"listen":              "Listen",
+	"grpc":                "GrpcPort",
+	"http":                "HttpPort",
+	"ui":                  "UiPort",
+	"verbose":             "Verbose",
+	"ndjson":              "Ndjson",
+	"capture":             "Capture",
+	"self":                "Self",
+	"self-interval":       "SelfInterval",
+	"forward":             "Forward",
+	"forward-compression": "ForwardCompression",
+	"forward-queue":       "ForwardQueue",
+	"generate":            "Generate",
+	"generate-rate":       "GenerateRate",
+	"tenant-header":       "TenantHeader",
+	"tenant-limit":        "TenantLimit",
+	"tui":                 "Tui",
+	"shutdown-timeout":    "ShutdownTimeout",
+	"final-export":        "FinalExport",
+}
+
+// Returns the settings from the default values and the flags, and the flag
+// set to know which flags were given
+func parseFlags(args []string) (*flag.FlagSet, server.Config, string) {
+	cfg := server.DefaultConfig()
+	fs := flag.NewFlagSet(os.Args[0], flag.ExitOnError)
+	var configPath string
+	fs.StringVar(&configPath, "config", "", "YAML config file; flags override its settings, and SIGHUP reloads it")
+	fs.StringVar(&cfg.Listen, "listen", cfg.Listen, "Host or IP address to listen on, eg. 0.0.0.0 (default localhost)")
+	fs.IntVar(&cfg.GrpcPort, "grpc", cfg.GrpcPort, "Port for OTLP/gRPC server (0 to disable)")
+	fs.IntVar(&cfg.HttpPort, "http", cfg.HttpPort, "Port for OTLP/HTTP server (0 to disable)")
+	fs.IntVar(&cfg.UiPort, "ui", cfg.UiPort, "Port for web interface")
+	fs.BoolVar(&cfg.Verbose, "verbose", cfg.Verbose, "Log incoming data")
+	fs.StringVar(&cfg.Ndjson, "ndjson", cfg.Ndjson, "Write each received span, log and metric point as a JSON line to a file, or \"-\" for stdout")
+	fs.BoolVar(&cfg.Capture, "capture", cfg.Capture, "Keep the raw body of each OTLP request")
+	fs.StringVar(&cfg.Self, "self", cfg.Self, "Emit telui's own telemetry: \"local\" to store it in telui, or an OTLP endpoint (grpc://host:port or http://host:port)")
+	fs.DurationVar(&cfg.SelfInterval, "self-interval", cfg.SelfInterval, "Interval between self-telemetry exports")
+	fs.StringVar(&cfg.Forward, "forward", cfg.Forward, "Also forward received telemetry to an OTLP endpoint (grpc://host:port or http://host:port)")
+	forwardHeaders := headerFlags{}
+	fs.Var(forwardHeaders, "forward-header", "Header to add to forwarded requests, as key=value (can be repeated)")
+	fs.StringVar(&cfg.ForwardCompression, "forward-compression", cfg.ForwardCompression, "Compression for forwarded requests (gzip or none)")
+	fs.IntVar(&cfg.ForwardQueue, "forward-queue", cfg.ForwardQueue, "Maximum number of batches waiting to be forwarded")
+	fs.BoolVar(&cfg.Generate, "generate", cfg.Generate, "Generate synthetic telemetry (can also be toggled from the web interface)")
+	fs.Float64Var(&cfg.GenerateRate, "generate-rate", cfg.GenerateRate, "Synthetic traces generated per second")
+	fs.StringVar(&cfg.TenantHeader, "tenant-header", cfg.TenantHeader, "Keep the telemetry of each value of this request header separate, eg. X-Scope-OrgID")
+	fs.IntVar(&cfg.TenantLimit, "tenant-limit", cfg.TenantLimit, "Maximum number of tenants besides the default one (0 for unlimited); telemetry of further tenants goes to the default tenant")
+	fs.BoolVar(&cfg.Tui, "tui", cfg.Tui, "Show received telemetry in the terminal (the web interface stays available)")
+	fs.DurationVar(&cfg.ShutdownTimeout, "shutdown-timeout", cfg.ShutdownTimeout, "How long to wait for in-flight requests and forwarding when stopping")
+	fs.StringVar(&cfg.FinalExport, "final-export", cfg.FinalExport, "When stopping, export everything received to a file (as OTLP/JSON lines) or an OTLP endpoint")
 
-	storage := newStorage(*verbose)
+	fs.Parse(args)
+	cfg.ForwardHeaders = forwardHeaders
+	return fs, cfg, configPath
+}
 
-	if *grpcPort != 0 {
-		otlpGrpc, err := serveOtlpGrpc(storage, *grpcPort)
-		if err != nil {
-			return err
+// Applies the flags given explicitly on top of cfg; forward headers are added
+// to those of cfg
+func applyFlags(fs *flag.FlagSet, flags server.Config, cfg *server.Config) {
+	src, dst := reflect.ValueOf(flags), reflect.ValueOf(cfg).Elem()
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == "forward-header" {
+			headers := maps.Clone(cfg.ForwardHeaders)
+			if headers == nil {
+				headers = map[string]string{}
+			}
+			maps.Copy(headers, flags.ForwardHeaders)
+			cfg.ForwardHeaders = headers
+		} else if field, ok := flagFields[f.Name]; ok {
+			dst.FieldByName(field).Set(src.FieldByName(field))
 		}
-		defer otlpGrpc.stop()
-	}
+	})
+}
 
-	if *httpPort != 0 {
-		otlpHttp, err := serveOtlpHttp(storage, *httpPort)
-		if err != nil {
-			return err
+func loadConfig(args []string) (server.Config, error) {
+	fs, flags, configPath := parseFlags(args)
+	if configPath == "" {
+		return flags, flags.Validate()
+	}
+	// Re-reads the file on SIGHUP, keeping the flags parsed at startup
+	load := func() (server.Config, error) {
+		cfg := server.DefaultConfig()
+		if err := server.LoadConfigFile(configPath, &cfg); err != nil {
+			return cfg, err
 		}
-		defer otlpHttp.stop()
+		applyFlags(fs, flags, &cfg)
+		return cfg, cfg.Validate()
 	}
+	cfg, err := load()
+	cfg.Reload = load
+	return cfg, err
+}
 
-	api, err := serveUi(storage, *uiPort)
+func start() error {
+	cfg, err := loadConfig(os.Args[1:])
 	if err != nil {
 		return err
 	}
-	defer api.stop()
-
-	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
-	<-c
-	fmt.Printf("\nStopping.\n")
-
-	return nil
+	return server.Run(cfg)
 }
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "expect":
+			os.Exit(runExpect(os.Args[2:]))
+		case "golden":
+			os.Exit(runGolden(os.Args[2:]))
+		case "query":
+			os.Exit(runQuery(os.Args[2:]))
+		}
+	}
+
 	err := start()
 	if err != nil {
 		fmt.Fprintf(os.Stderr, "Failed to start server: %v\n", err)
@@ -0,0 +1,342 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/http"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Typed values in the UI API, see value.go in the server package
+type apiTs struct {
+	Ts string `json:"_ts"`
+}
+type apiInt struct {
+	Int string `json:"_int"`
+}
+type apiId struct {
+	Span  string `json:"_span"`
+	Res   string `json:"_res"`
+	Scope string `json:"_scope"`
+}
+
+func (t apiTs) time() time.Time {
+	ns, _ := strconv.ParseInt(t.Ts, 10, 64)
+	return time.Unix(0, ns)
+}
+
+type apiSpan struct {
+	Parent apiId  `json:"parent"`
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Start  apiTs  `json:"start"`
+	End    apiTs  `json:"end"`
+}
+
+type apiLog struct {
+	Id   apiInt `json:"id"`
+	Time apiTs  `json:"time"`
+	Sev  string `json:"sev"`
+	Body string `json:"body"`
+}
+
+type apiMetrics struct {
+	Metrics map[string]struct {
+		Res   apiId  `json:"res"`
+		Scope apiId  `json:"scope"`
+		Name  string `json:"name"`
+		Type  string `json:"type"`
+		Unit  string `json:"unit"`
+		Desc  string `json:"desc"`
+	} `json:"metrics"`
+	Resources map[string]struct {
+		Attr map[string]any `json:"attr"`
+	} `json:"resources"`
+	Scopes map[string]struct {
+		Name string `json:"name"`
+	} `json:"scopes"`
+}
+
+// One printed result; the keys are the JSON field names and table headers
+type queryRow struct {
+	keys   []string
+	values []any
+}
+
+func (r *queryRow) add(k string, v any) {
+	r.keys = append(r.keys, k)
+	r.values = append(r.values, v)
+}
+
+func (r queryRow) MarshalJSON() ([]byte, error) {
+	var b strings.Builder
+	b.WriteByte('{')
+	for i, k := range r.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		kj, _ := json.Marshal(k)
+		vj, err := json.Marshal(r.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(kj)
+		b.WriteByte(':')
+		b.Write(vj)
+	}
+	b.WriteByte('}')
+	return []byte(b.String()), nil
+}
+
+func formatCell(v any) string {
+	switch v := v.(type) {
+	case time.Time:
+		return v.Format("2006-01-02 15:04:05.000")
+	case time.Duration:
+		return v.String()
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func printRows(w io.Writer, format string, rows []queryRow) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if rows == nil {
+			rows = []queryRow{}
+		}
+		return enc.Encode(rows)
+	case "ndjson":
+		enc := json.NewEncoder(w)
+		for _, r := range rows {
+			if err := enc.Encode(r); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		if len(rows) == 0 {
+			fmt.Fprintln(w, "No results.")
+			return nil
+		}
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.ToUpper(strings.Join(rows[0].keys, "\t")))
+		for _, r := range rows {
+			cells := make([]string, len(r.values))
+			for i, v := range r.values {
+				cells[i] = strings.ReplaceAll(formatCell(v), "\t", " ")
+			}
+			fmt.Fprintln(tw, strings.Join(cells, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+type queryClient struct {
+	base   string
+	filter url.Values
+}
+
+func (qc queryClient) get(path string, dst any) error {
+	u := qc.base + path
+	if len(qc.filter) > 0 {
+		u += "?" + qc.filter.Encode()
+	}
+	resp, err := http.Get(u)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(resp.Body)
+		return fmt.Errorf("%s: %s: %s", path, resp.Status, strings.TrimSpace(string(msg)))
+	}
+	return json.NewDecoder(resp.Body).Decode(dst)
+}
+
+func (qc queryClient) traces() ([]queryRow, error) {
+	var traces map[string]map[string]apiSpan
+	if err := qc.get("/api/traces", &traces); err != nil {
+		return nil, err
+	}
+	type spanRow struct {
+		tid, sid string
+		apiSpan
+	}
+	var spans []spanRow
+	for tid, tr := range traces {
+		for sid, sp := range tr {
+			spans = append(spans, spanRow{tid, sid, sp})
+		}
+	}
+	slices.SortFunc(spans, func(a, b spanRow) int {
+		return cmp.Or(a.Start.time().Compare(b.Start.time()), cmp.Compare(a.tid, b.tid), cmp.Compare(a.sid, b.sid))
+	})
+	rows := make([]queryRow, 0, len(spans))
+	for _, sp := range spans {
+		var r queryRow
+		r.add("start", sp.Start.time())
+		r.add("duration", sp.End.time().Sub(sp.Start.time()))
+		r.add("trace", sp.tid)
+		r.add("span", sp.sid)
+		r.add("parent", sp.Parent.Span)
+		r.add("status", sp.Status)
+		r.add("name", sp.Name)
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+func (qc queryClient) logs() ([]queryRow, error) {
+	var logs []apiLog
+	if err := qc.get("/api/logs", &logs); err != nil {
+		return nil, err
+	}
+	slices.SortStableFunc(logs, func(a, b apiLog) int {
+		return a.Time.time().Compare(b.Time.time())
+	})
+	rows := make([]queryRow, 0, len(logs))
+	for _, l := range logs {
+		id, _ := strconv.Atoi(l.Id.Int)
+		var r queryRow
+		r.add("time", l.Time.time())
+		r.add("id", id)
+		r.add("severity", l.Sev)
+		r.add("body", l.Body)
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+func (qc queryClient) metrics() ([]queryRow, error) {
+	var data apiMetrics
+	if err := qc.get("/api/metrics", &data); err != nil {
+		return nil, err
+	}
+	service := func(mid string) string {
+		name, _ := data.Resources[data.Metrics[mid].Res.Res].Attr["service.name"].(string)
+		return name
+	}
+	mids := slices.Collect(maps.Keys(data.Metrics))
+	slices.SortFunc(mids, func(a, b string) int {
+		return cmp.Or(cmp.Compare(service(a), service(b)), cmp.Compare(data.Metrics[a].Name, data.Metrics[b].Name), cmp.Compare(a, b))
+	})
+	rows := make([]queryRow, 0, len(mids))
+	for _, mid := range mids {
+		me := data.Metrics[mid]
+		var r queryRow
+		r.add("service", service(mid))
+		r.add("scope", data.Scopes[me.Scope.Scope].Name)
+		r.add("name", me.Name)
+		r.add("type", me.Type)
+		r.add("unit", me.Unit)
+		r.add("id", mid)
+		rows = append(rows, r)
+	}
+	return rows, nil
+}
+
+type attrFlags []string
+
+func (af *attrFlags) String() string {
+	return strings.Join(*af, ",")
+}
+
+func (af *attrFlags) Set(s string) error {
+	if k, _, ok := strings.Cut(s, "="); !ok || k == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	*af = append(*af, s)
+	return nil
+}
+
+// Accepts a port number, host:port, or a full URL
+func uiBaseUrl(s string) string {
+	if _, err := strconv.Atoi(s); err == nil {
+		return "http://localhost:" + s
+	}
+	if !strings.Contains(s, "://") {
+		s = "http://" + s
+	}
+	return strings.TrimSuffix(s, "/")
+}
+
+// Exit codes: 0 on success, 1 if the instance could not be queried, 2 on usage errors
+func runQuery(args []string) int {
+	fs := flag.NewFlagSet("telui query", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprintf(fs.Output(), "Usage: telui query traces|logs|metrics [flags]\n")
+		fs.PrintDefaults()
+	}
+	ui := fs.String("ui", "8080", "Web interface of the running instance: port, host:port or URL")
+	format := fs.String("o", "table", "Output format: table, json or ndjson")
+	name := fs.String("name", "", "Only items whose name contains this (spans, metrics, log event names)")
+	service := fs.String("service", "", "Only items from this service.name")
+	var attrs attrFlags
+	fs.Var(&attrs, "attr", "Only items with this attribute, as key=value (repeatable)")
+	status := fs.String("status", "", "Only spans with this status (Ok, Error)")
+	severity := fs.String("severity", "", "Only logs with this severity (Error also matches Error2 to Error4)")
+	body := fs.String("body", "", "Only logs whose body contains this")
+	trace := fs.String("trace", "", "Only spans and logs from this trace ID")
+	tenant := fs.String("tenant", "", "Query this tenant's telemetry, when telui separates tenants")
+	since := fs.Duration("since", 0, "Only items from the last duration, eg. 5m")
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fs.Usage()
+		return 2
+	}
+	kind := args[0]
+	fs.Parse(args[1:])
+	if fs.NArg() != 0 || !slices.Contains([]string{"table", "json", "ndjson"}, *format) {
+		fs.Usage()
+		return 2
+	}
+
+	filter := url.Values{}
+	for k, v := range map[string]string{"name": *name, "service": *service, "status": *status, "sev": *severity, "body": *body, "trace": *trace, "tenant": *tenant} {
+		if v != "" {
+			filter.Set(k, v)
+		}
+	}
+	for _, kv := range attrs {
+		filter.Add("attr", kv)
+	}
+	if *since > 0 {
+		filter.Set("since", since.String())
+	}
+	qc := queryClient{base: uiBaseUrl(*ui), filter: filter}
+
+	var rows []queryRow
+	var err error
+	switch kind {
+	case "traces":
+		rows, err = qc.traces()
+	case "logs":
+		rows, err = qc.logs()
+	case "metrics":
+		rows, err = qc.metrics()
+	default:
+		fs.Usage()
+		return 2
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Query failed: %v\n", err)
+		return 1
+	}
+	if err := printRows(os.Stdout, *format, rows); err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to print results: %v\n", err)
+		return 1
+	}
+	return 0
+}
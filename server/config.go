@@ -0,0 +1,375 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultConfig returns the settings used when neither flags nor the config
+// file set them.
+func DefaultConfig() Config {
+	return Config{
+		GrpcPort:           4317,
+		HttpPort:           4318,
+		UiPort:             8080,
+		SelfInterval:       10 * time.Second,
+		ForwardCompression: "gzip",
+		ForwardQueue:       1000,
+		GenerateRate:       5,
+		ShutdownTimeout:    10 * time.Second,
+		TenantLimit:        100,
+		SamplePercentage:   100,
+		TailWait:           10 * time.Second,
+	}
+}
+
+// The layout of the config file, see config.example.yaml
+type fileConfig struct {
+	Listen  string `yaml:"listen"`
+	Grpc    int    `yaml:"grpc"`
+	Http    int    `yaml:"http"`
+	Ui      int    `yaml:"ui"`
+	Verbose bool   `yaml:"verbose"`
+	Capture bool   `yaml:"capture"`
+	Tui     bool   `yaml:"tui"`
+	Ndjson  string `yaml:"ndjson"`
+	Tenants struct {
+		Header string `yaml:"header"`
+		Limit  int    `yaml:"limit"`
+	} `yaml:"tenants"`
+	Self struct {
+		Target   string        `yaml:"target"`
+		Interval time.Duration `yaml:"interval"`
+	} `yaml:"self"`
+	Forward struct {
+		Endpoint    string            `yaml:"endpoint"`
+		Headers     map[string]string `yaml:"headers"`
+		Compression string            `yaml:"compression"`
+		Queue       int               `yaml:"queue"`
+	} `yaml:"forward"`
+	Generate struct {
+		Enabled bool    `yaml:"enabled"`
+		Rate    float64 `yaml:"rate"`
+	} `yaml:"generate"`
+	Shutdown struct {
+		Timeout time.Duration `yaml:"timeout"`
+		Export  string        `yaml:"export"`
+	} `yaml:"shutdown"`
+	Sampling struct {
+		Percentage float64 `yaml:"percentage"`
+		Rate       float64 `yaml:"rate"`
+		Tail       struct {
+			Wait       time.Duration `yaml:"wait"`
+			Errors     bool          `yaml:"errors"`
+			Latency    time.Duration `yaml:"latency"`
+			Percentage float64       `yaml:"percentage"`
+		} `yaml:"tail"`
+	} `yaml:"sampling"`
+	Redact struct {
+		Attributes []RedactRule `yaml:"attributes"`
+		Headers    []string     `yaml:"headers"`
+	} `yaml:"redact"`
+}
+
+func (fc *fileConfig) from(cfg Config) {
+	fc.Listen, fc.Grpc, fc.Http, fc.Ui = cfg.Listen, cfg.GrpcPort, cfg.HttpPort, cfg.UiPort
+	fc.Verbose, fc.Capture, fc.Tui, fc.Ndjson = cfg.Verbose, cfg.Capture, cfg.Tui, cfg.Ndjson
+	fc.Self.Target, fc.Self.Interval = cfg.Self, cfg.SelfInterval
+	fc.Forward.Endpoint, fc.Forward.Headers = cfg.Forward, cfg.ForwardHeaders
+	fc.Forward.Compression, fc.Forward.Queue = cfg.ForwardCompression, cfg.ForwardQueue
+	fc.Generate.Enabled, fc.Generate.Rate = cfg.Generate, cfg.GenerateRate
+	fc.Shutdown.Timeout, fc.Shutdown.Export = cfg.ShutdownTimeout, cfg.FinalExport
+	fc.Tenants.Header, fc.Tenants.Limit = cfg.TenantHeader, cfg.TenantLimit
+	fc.Redact.Attributes, fc.Redact.Headers = cfg.RedactRules, cfg.RedactHeaders
+	fc.Sampling.Percentage, fc.Sampling.Rate = cfg.SamplePercentage, cfg.SampleRate
+	fc.Sampling.Tail.Wait, fc.Sampling.Tail.Errors = cfg.TailWait, cfg.TailErrors
+	fc.Sampling.Tail.Latency, fc.Sampling.Tail.Percentage = cfg.TailLatency, cfg.TailPercentage
+}
+
+func (fc *fileConfig) to(cfg *Config) {
+	cfg.Listen, cfg.GrpcPort, cfg.HttpPort, cfg.UiPort = fc.Listen, fc.Grpc, fc.Http, fc.Ui
+	cfg.Verbose, cfg.Capture, cfg.Tui, cfg.Ndjson = fc.Verbose, fc.Capture, fc.Tui, fc.Ndjson
+	cfg.Self, cfg.SelfInterval = fc.Self.Target, fc.Self.Interval
+	cfg.Forward, cfg.ForwardHeaders = fc.Forward.Endpoint, fc.Forward.Headers
+	cfg.ForwardCompression, cfg.ForwardQueue = fc.Forward.Compression, fc.Forward.Queue
+	cfg.Generate, cfg.GenerateRate = fc.Generate.Enabled, fc.Generate.Rate
+	cfg.ShutdownTimeout, cfg.FinalExport = fc.Shutdown.Timeout, fc.Shutdown.Export
+	cfg.TenantHeader, cfg.TenantLimit = fc.Tenants.Header, fc.Tenants.Limit
+	cfg.RedactRules, cfg.RedactHeaders = fc.Redact.Attributes, fc.Redact.Headers
+	cfg.SamplePercentage, cfg.SampleRate = fc.Sampling.Percentage, fc.Sampling.Rate
+	cfg.TailWait, cfg.TailErrors = fc.Sampling.Tail.Wait, fc.Sampling.Tail.Errors
+	cfg.TailLatency, cfg.TailPercentage = fc.Sampling.Tail.Latency, fc.Sampling.Tail.Percentage
+}
+
+func (cfg Config) sampling() samplingSettings {
+	return samplingSettings{
+		head:        cfg.SamplePercentage / 100,
+		rate:        cfg.SampleRate,
+		tailWait:    cfg.TailWait,
+		tailErrors:  cfg.TailErrors,
+		tailLatency: cfg.TailLatency,
+		tailRatio:   cfg.TailPercentage / 100,
+	}
+}
+
+// An invalid setting; key is its path in the config file, eg. "forward.queue"
+type configError struct {
+	key string
+	msg string
+}
+
+func (ce configError) Error() string {
+	return ce.key + ": " + ce.msg
+}
+
+func (cfg Config) validate() []configError {
+	var errs []configError
+	for key, port := range map[string]int{"grpc": cfg.GrpcPort, "http": cfg.HttpPort, "ui": cfg.UiPort} {
+		if port < 0 || port > 65535 {
+			errs = append(errs, configError{key, fmt.Sprintf("invalid port %d", port)})
+		}
+	}
+	if _, _, err := net.SplitHostPort(cfg.Listen); err == nil {
+		errs = append(errs, configError{"listen", fmt.Sprintf("must be a host without a port, got %q", cfg.Listen)})
+	}
+	if cfg.SelfInterval <= 0 {
+		errs = append(errs, configError{"self.interval", "must be positive"})
+	}
+	if cfg.ForwardCompression != "gzip" && cfg.ForwardCompression != "none" {
+		errs = append(errs, configError{"forward.compression", fmt.Sprintf("must be gzip or none, got %q", cfg.ForwardCompression)})
+	}
+	if cfg.ForwardQueue <= 0 {
+		errs = append(errs, configError{"forward.queue", "must be positive"})
+	}
+	if cfg.GenerateRate <= 0 {
+		errs = append(errs, configError{"generate.rate", "must be positive"})
+	}
+	if cfg.ShutdownTimeout <= 0 {
+		errs = append(errs, configError{"shutdown.timeout", "must be positive"})
+	}
+	if cfg.TenantLimit < 0 {
+		errs = append(errs, configError{"tenants.limit", "must not be negative"})
+	}
+	if cfg.Tui && cfg.Verbose {
+		errs = append(errs, configError{"tui", "cannot be used together with verbose"})
+	}
+	if cfg.Tui && cfg.TenantHeader != "" {
+		errs = append(errs, configError{"tui", "cannot be used together with tenants.header, as the terminal UI only shows the default tenant"})
+	}
+	if cfg.Ndjson == "-" && (cfg.Tui || cfg.Verbose) {
+		errs = append(errs, configError{"ndjson", "cannot be stdout (\"-\") with tui or verbose, which also write to stdout"})
+	}
+	for key, pct := range map[string]float64{"sampling.percentage": cfg.SamplePercentage, "sampling.tail.percentage": cfg.TailPercentage} {
+		if pct < 0 || pct > 100 {
+			errs = append(errs, configError{key, fmt.Sprintf("must be between 0 and 100, got %g", pct)})
+		}
+	}
+	if cfg.SampleRate < 0 {
+		errs = append(errs, configError{"sampling.rate", "must not be negative"})
+	}
+	if cfg.TailWait <= 0 {
+		errs = append(errs, configError{"sampling.tail.wait", "must be positive"})
+	}
+	if cfg.TailLatency < 0 {
+		errs = append(errs, configError{"sampling.tail.latency", "must not be negative"})
+	}
+	for i, r := range cfg.RedactRules {
+		if _, field, err := r.compile(); err != nil {
+			errs = append(errs, configError{fmt.Sprintf("redact.attributes.%d.%s", i, field), err.Error()})
+		}
+	}
+	return errs
+}
+
+// Validate checks the settings, whether they come from flags or a config file.
+func (cfg Config) Validate() error {
+	var errs []error
+	for _, ce := range cfg.validate() {
+		errs = append(errs, ce)
+	}
+	return errors.Join(errs...)
+}
+
+// Finds the line of a dotted key in a YAML document, or of its closest parent
+func keyLine(doc *yaml.Node, key string) int {
+	node := doc
+	if node.Kind == yaml.DocumentNode && len(node.Content) > 0 {
+		node = node.Content[0]
+	}
+	line := node.Line
+	for _, part := range strings.Split(key, ".") {
+		if node.Kind == yaml.SequenceNode {
+			i, err := strconv.Atoi(part)
+			if err != nil || i >= len(node.Content) {
+				break
+			}
+			node = node.Content[i]
+			line = node.Line
+			continue
+		}
+		if node.Kind != yaml.MappingNode {
+			break
+		}
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == part {
+				line = node.Content[i].Line
+				next = node.Content[i+1]
+			}
+		}
+		if next == nil {
+			break
+		}
+		node = next
+	}
+	return line
+}
+
+var yamlLineRe = regexp.MustCompile(`line (\d+): `)
+var yamlTypeRe = regexp.MustCompile(` in type \S+`)
+
+// Turns "line 3: field x not found in type server.fileConfig" into "<path>:3: field x not found"
+func yamlError(path string, msg string) string {
+	msg = strings.TrimPrefix(msg, "yaml: ")
+	return path + ":" + yamlTypeRe.ReplaceAllString(yamlLineRe.ReplaceAllString(msg, "$1: "), "")
+}
+
+// Settings which telui does not have, with what to do instead, so that the
+// config file reports them better than as unknown keys
+var unsupportedKeys = map[string]string{
+	"tls":       "not supported, put telui behind a proxy which terminates TLS",
+	"auth":      "not supported, keep telui on localhost (the default listen address) or put it behind an authenticating proxy",
+	"retention": "not supported, telemetry is kept in memory until it is reset or deleted",
+}
+
+// LoadConfigFile applies the settings of a YAML config file on top of cfg.
+// Errors mention the file and line of the offending setting.
+func LoadConfigFile(path string, cfg *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return errors.New(yamlError(path, err.Error()))
+	}
+	if len(doc.Content) > 0 && doc.Content[0].Kind == yaml.MappingNode {
+		var msgs []string
+		keys := doc.Content[0].Content
+		for i := 0; i+1 < len(keys); i += 2 {
+			if msg, ok := unsupportedKeys[keys[i].Value]; ok {
+				msgs = append(msgs, path+":"+strconv.Itoa(keys[i].Line)+": "+keys[i].Value+": "+msg)
+			}
+		}
+		if len(msgs) > 0 {
+			return errors.New(strings.Join(msgs, "\n"))
+		}
+	}
+
+	var fc fileConfig
+	fc.from(*cfg)
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&fc); err != nil && !errors.Is(err, io.EOF) {
+		var te *yaml.TypeError
+		if errors.As(err, &te) {
+			var msgs []string
+			for _, e := range te.Errors {
+				msgs = append(msgs, yamlError(path, e))
+			}
+			return errors.New(strings.Join(msgs, "\n"))
+		}
+		return errors.New(yamlError(path, err.Error()))
+	}
+	var cfg2 Config = *cfg
+	fc.to(&cfg2)
+	if ces := cfg2.validate(); len(ces) > 0 {
+		var msgs []string
+		for _, ce := range ces {
+			msgs = append(msgs, path+":"+strconv.Itoa(keyLine(&doc, ce.key))+": "+ce.Error())
+		}
+		return errors.New(strings.Join(msgs, "\n"))
+	}
+	*cfg = cfg2
+	return nil
+}
+
+// Config fields which need a restart when changed, by config file key;
+// verbose, capture and generate.* are applied on reload
+var restartFields = map[string]string{
+	"Listen":             "listen",
+	"GrpcPort":           "grpc",
+	"HttpPort":           "http",
+	"UiPort":             "ui",
+	"Tui":                "tui",
+	"Ndjson":             "ndjson",
+	"Self":               "self.target",
+	"SelfInterval":       "self.interval",
+	"Forward":            "forward.endpoint",
+	"ForwardHeaders":     "forward.headers",
+	"ForwardCompression": "forward.compression",
+	"ForwardQueue":       "forward.queue",
+	"ShutdownTimeout":    "shutdown.timeout",
+	"FinalExport":        "shutdown.export",
+	"TenantHeader":       "tenants.header",
+	"TenantLimit":        "tenants.limit",
+	"RedactRules":        "redact.attributes",
+	"RedactHeaders":      "redact.headers",
+	"SamplePercentage":   "sampling.percentage",
+	"SampleRate":         "sampling.rate",
+	"TailWait":           "sampling.tail.wait",
+	"TailErrors":         "sampling.tail.errors",
+	"TailLatency":        "sampling.tail.latency",
+	"TailPercentage":     "sampling.tail.percentage",
+}
+
+// Lists the settings which changed but need a restart to take effect
+func restartNeeded(old Config, new Config) []string {
+	var keys []string
+	v1, v2 := reflect.ValueOf(old), reflect.ValueOf(new)
+	for i := range v1.NumField() {
+		key, ok := restartFields[v1.Type().Field(i).Name]
+		if ok && !reflect.DeepEqual(v1.Field(i).Interface(), v2.Field(i).Interface()) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+func reloadConfig(cfg *Config, st *storage, gen *generator) {
+	newCfg, err := cfg.Reload()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to reload config, keeping the current one:\n%v\n", err)
+		return
+	}
+	if keys := restartNeeded(*cfg, newCfg); len(keys) > 0 {
+		fmt.Fprintf(os.Stderr, "Restart telui to apply changes to: %s\n", strings.Join(keys, ", "))
+	}
+	st.verbose.Store(newCfg.Verbose)
+	st.capture.Store(newCfg.Capture)
+	// The generator can also be toggled from the UI, so only apply actual changes
+	if newCfg.GenerateRate != cfg.GenerateRate {
+		gen.setRate(newCfg.GenerateRate)
+	}
+	if newCfg.Generate != cfg.Generate {
+		if newCfg.Generate {
+			gen.startGenerating()
+		} else {
+			gen.stop()
+		}
+	}
+	cfg.Verbose, cfg.Capture = newCfg.Verbose, newCfg.Capture
+	cfg.Generate, cfg.GenerateRate = newCfg.Generate, newCfg.GenerateRate
+	fmt.Fprintf(st.messages, "Reloaded config\n")
+}
@@ -0,0 +1,60 @@
+package server
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestConfigFileErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		yaml string
+		want []string
+	}{
+		{"type", "grpc: 4317\nui: lots\n", []string{":2: "}},
+		{"unknown key", "grpc: 4317\n\nverbos: true\n", []string{":3: ", "verbos"}},
+		{"validation", "generate:\n  enabled: true\n  rate: -1\n", []string{":3: generate.rate: must be positive"}},
+		{"unsupported", "ui: 8080\ntls:\n  cert: x.pem\n", []string{":2: tls: not supported"}},
+		{"syntax", "ui: 8080\nforward: [\n", []string{"config.yaml:"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "config.yaml")
+			if err := os.WriteFile(path, []byte(tt.yaml), 0o644); err != nil {
+				t.Fatal(err)
+			}
+			cfg := DefaultConfig()
+			err := LoadConfigFile(path, &cfg)
+			if err == nil {
+				t.Fatal("no error")
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(err.Error(), want) {
+					t.Errorf("error %q does not contain %q", err, want)
+				}
+			}
+			if cfg.UiPort != 8080 {
+				t.Errorf("settings were applied despite the error")
+			}
+		})
+	}
+}
+
+func TestConfigFileOverrides(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(path, []byte("ui: 9090\nforward:\n  queue: 5\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := DefaultConfig()
+	if err := LoadConfigFile(path, &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.UiPort != 9090 || cfg.ForwardQueue != 5 {
+		t.Errorf("ui = %d, forward.queue = %d, want 9090 and 5", cfg.UiPort, cfg.ForwardQueue)
+	}
+	if cfg.GrpcPort != 4317 {
+		t.Errorf("grpc = %d, want the default 4317 to be kept", cfg.GrpcPort)
+	}
+}
@@ -0,0 +1,212 @@
+package server
+
+import (
+	"maps"
+	"slices"
+)
+
+// What a deletion removed
+type deletion struct {
+	spans    int
+	logs     int
+	metrics  int
+	profiles int
+	calls    int
+	pinned   int // traces, logs and metrics kept because they are pinned
+}
+
+func (d deletion) toJson(m *mapifier) {
+	m.pair("spans", intValue(d.spans))
+	m.pair("logs", intValue(d.logs))
+	m.pair("metrics", intValue(d.metrics))
+	m.pair("profiles", intValue(d.profiles))
+	m.pair("calls", intValue(d.calls))
+	m.pair("pinned", intValue(d.pinned))
+}
+
+// The deletion methods must be called with the storage locked. Pinned items
+// are never deleted: deleting one alone keeps it, and counts it as pinned.
+
+func (st *storage) deleteTrace(tid traceId) (deletion, bool) {
+	tr, ok := st.traces[tid]
+	if !ok {
+		return deletion{}, false
+	}
+	if st.isPinned(tracePin(tid)) {
+		return deletion{pinned: 1}, true
+	}
+	delete(st.traces, tid)
+	st.collectGarbage()
+	return deletion{spans: len(tr.spans)}, true
+}
+
+// A nil filter deletes all logs; pinned ones are kept, and counted as pinned
+func (st *storage) deleteLogs(f *itemFilter) deletion {
+	var d deletion
+	n := len(st.logs)
+	st.logs = slices.DeleteFunc(st.logs, func(l log) bool {
+		if !f.matchLog(st, l) {
+			return false
+		}
+		if st.isPinned(logPin(l.id)) {
+			d.pinned++
+			return false
+		}
+		return true
+	})
+	d.logs = n - len(st.logs)
+	st.reindexLogs()
+	st.collectGarbage()
+	return d
+}
+
+func (st *storage) deleteLog(id int) (deletion, bool) {
+	i, ok := st.logIndex(id)
+	if !ok {
+		return deletion{}, false
+	}
+	if st.isPinned(logPin(id)) {
+		return deletion{pinned: 1}, true
+	}
+	st.unindexLog(st.logs[i])
+	st.logs = slices.Delete(st.logs, i, i+1)
+	st.collectGarbage()
+	return deletion{logs: 1}, true
+}
+
+func (st *storage) deleteMetric(mid hashId) (deletion, bool) {
+	if _, ok := st.metrics[mid]; !ok {
+		return deletion{}, false
+	}
+	if st.isPinned(metricPin(mid)) {
+		return deletion{pinned: 1}, true
+	}
+	delete(st.metrics, mid)
+	st.collectGarbage()
+	return deletion{metrics: 1}, true
+}
+
+// Deletes everything sent with the matching resources, including the record of
+// the calls which only carried them. Pinned traces, logs and metrics are kept
+// whole, and counted as pinned.
+func (st *storage) deleteResources(match func(resId, resource) bool) deletion {
+	var d deletion
+	gone := map[resId]bool{}
+	for rid, res := range st.resources {
+		if match(rid, res) {
+			gone[rid] = true
+		}
+	}
+	for tid, tr := range st.traces {
+		if st.isPinned(tracePin(tid)) {
+			for _, sp := range tr.spans {
+				if gone[sp.res] {
+					d.pinned++
+					break
+				}
+			}
+			continue
+		}
+		for sid, sp := range tr.spans {
+			if gone[sp.res] {
+				delete(tr.spans, sid)
+				d.spans++
+			}
+		}
+		if len(tr.spans) == 0 {
+			delete(st.traces, tid)
+		}
+	}
+	n := len(st.logs)
+	st.logs = slices.DeleteFunc(st.logs, func(l log) bool {
+		if !gone[l.res] {
+			return false
+		}
+		if st.isPinned(logPin(l.id)) {
+			d.pinned++
+			return false
+		}
+		return true
+	})
+	d.logs = n - len(st.logs)
+	st.reindexLogs()
+	for mid, m := range st.metrics {
+		if !gone[m.res] {
+			continue
+		}
+		if st.isPinned(metricPin(mid)) {
+			d.pinned++
+		} else {
+			delete(st.metrics, mid)
+			d.metrics++
+		}
+	}
+	n = len(st.profiles)
+	st.profiles = slices.DeleteFunc(st.profiles, func(p profile) bool { return gone[p.res] })
+	d.profiles = n - len(st.profiles)
+	var calls []exportCall
+	for _, c := range st.calls {
+		if len(c.items) > 0 {
+			c.items = maps.Clone(c.items)
+			maps.DeleteFunc(c.items, func(rid resId, _ int) bool { return gone[rid] })
+			if len(c.items) == 0 {
+				d.calls++
+				continue
+			}
+		}
+		calls = append(calls, c)
+	}
+	st.calls = calls
+	st.collectGarbage()
+	return d
+}
+
+// Forgets the resources, scopes and requests which nothing refers to anymore
+func (st *storage) collectGarbage() {
+	// Requests being received refer to entries which no stored item refers to
+	// yet, so wait until they are done
+	if st.receiving > 0 {
+		st.gcPending = true
+		return
+	}
+	st.gcPending = false
+	reqs := map[reqId]bool{}
+	resources := map[resId]bool{}
+	scopes := map[scopeId]bool{}
+	ref := func(req reqId, res resId, scope scopeId) {
+		reqs[req] = true
+		resources[res] = true
+		scopes[scope] = true
+	}
+	for _, tr := range st.traces {
+		for _, sp := range tr.spans {
+			ref(sp.req, sp.res, sp.scope)
+		}
+	}
+	for _, l := range st.logs {
+		ref(l.req, l.res, l.scope)
+	}
+	for _, m := range st.metrics {
+		resources[m.res] = true
+		scopes[m.scope] = true
+		for _, ms := range m.streams {
+			for _, pt := range ms.points {
+				reqs[pt.getPoint().req] = true
+			}
+		}
+	}
+	for _, p := range st.profiles {
+		ref(p.req, p.res, p.scope)
+	}
+	for _, c := range st.calls {
+		reqs[c.req] = true
+		for rid := range c.items {
+			resources[rid] = true
+		}
+	}
+	st.sampler.references(st, ref)
+
+	maps.DeleteFunc(st.requests, func(id reqId, _ requestMeta) bool { return !reqs[id] })
+	maps.DeleteFunc(st.resources, func(id resId, _ resource) bool { return !resources[id] })
+	maps.DeleteFunc(st.scopes, func(id scopeId, _ scope) bool { return !scopes[id] })
+}
@@ -0,0 +1,78 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+)
+
+func deleteRequest(mux http.Handler, path string) int {
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest(http.MethodDelete, path, nil))
+	return w.Code
+}
+
+func TestDeleteCollectsGarbage(t *testing.T) {
+	st := testStorage(false)
+	receiveTestLogs(t, st, testRequest("User-Agent", "a"), testLogs("frontend", "hello"))
+	receiveTestLogs(t, st, testRequest("User-Agent", "b"), testLogs("checkout", "one", "two"))
+	if len(st.resources) != 2 || len(st.requests) != 2 {
+		t.Fatalf("got %d resources and %d requests, want 2 of each", len(st.resources), len(st.requests))
+	}
+
+	mux := uiMux(st, nil)
+	if code := deleteRequest(mux, "/api/service/checkout"); code != http.StatusOK {
+		t.Fatalf("deleting the checkout service returned %d", code)
+	}
+	if len(st.logs) != 1 || len(st.calls) != 1 {
+		t.Errorf("got %d logs and %d calls, want those of frontend only", len(st.logs), len(st.calls))
+	}
+	if len(st.resources) != 1 || len(st.requests) != 1 || len(st.scopes) != 1 {
+		t.Errorf("got %d resources, %d requests and %d scopes, want those of frontend only",
+			len(st.resources), len(st.requests), len(st.scopes))
+	}
+	if code := deleteRequest(mux, "/api/service/checkout"); code != http.StatusNotFound {
+		t.Errorf("deleting a service which is gone returned %d, want 404", code)
+	}
+
+	var rid resId
+	for id := range st.resources {
+		rid = id
+	}
+	if code := deleteRequest(mux, "/api/resource/"+hashToString(uint64(rid))); code != http.StatusOK {
+		t.Fatalf("deleting the frontend resource returned %d", code)
+	}
+	if len(st.logs) != 0 || len(st.calls) != 0 {
+		t.Errorf("got %d logs and %d calls left, want none", len(st.logs), len(st.calls))
+	}
+	if len(st.resources) != 0 || len(st.requests) != 0 || len(st.scopes) != 0 {
+		t.Errorf("got %d resources, %d requests and %d scopes left, want none",
+			len(st.resources), len(st.requests), len(st.scopes))
+	}
+}
+
+func TestDeletePinned(t *testing.T) {
+	st := testStorage(false)
+	receiveTestLogs(t, st, testRequest(), testLogs("checkout", "pinned", "other"))
+	pinned := st.logs[0].id
+	st.setPin(logPin(pinned), "")
+
+	mux := uiMux(st, nil)
+	if code := deleteRequest(mux, "/api/log/"+strconv.Itoa(pinned)); code != http.StatusConflict {
+		t.Errorf("deleting a pinned log returned %d, want 409", code)
+	}
+	if _, ok := st.logIndex(pinned); !ok || !st.isPinned(logPin(pinned)) {
+		t.Fatal("the pinned log or its pin was deleted")
+	}
+
+	st.Lock()
+	d := st.deleteLogs(nil)
+	st.Unlock()
+	if d.logs != 1 || d.pinned != 1 {
+		t.Errorf("deleted %d logs and kept %d pinned ones, want 1 and 1", d.logs, d.pinned)
+	}
+	if len(st.logs) != 1 || st.logs[0].id != pinned {
+		t.Errorf("got %d logs, want only the pinned one", len(st.logs))
+	}
+}
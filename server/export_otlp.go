@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+var otlpHttpPaths = map[string]string{
+	"traces":   "/v1/traces",
+	"logs":     "/v1/logs",
+	"metrics":  "/v1/metrics",
+	"profiles": "/v1development/profiles",
+}
+
+func requestSignal(req exportRequest) string {
+	switch req.(type) {
+	case *ptraceotlp.ExportRequest:
+		return "traces"
+	case *plogotlp.ExportRequest:
+		return "logs"
+	case *pmetricotlp.ExportRequest:
+		return "metrics"
+	case *pprofileotlp.ExportRequest:
+		return "profiles"
+	default:
+		panic("unknown export request type")
+	}
+}
+
+type otlpClient struct {
+	endpoint    string
+	headers     map[string]string
+	compression string
+	conn        *grpc.ClientConn
+	http        *http.Client
+}
+
+// Endpoints are either grpc://host:port or an http(s):// base URL. The
+// compression is "gzip", or "" or "none" for none.
+func newOtlpClient(endpoint string, headers map[string]string, compression string) (*otlpClient, error) {
+	if compression == "none" {
+		compression = ""
+	}
+	if compression != "" && compression != "gzip" {
+		return nil, fmt.Errorf("unsupported compression %q", compression)
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OTLP endpoint: %w", err)
+	}
+	c := &otlpClient{
+		endpoint:    strings.TrimSuffix(endpoint, "/"),
+		headers:     headers,
+		compression: compression,
+	}
+	switch u.Scheme {
+	case "grpc":
+		c.conn, err = grpc.NewClient(u.Host,
+			grpc.WithTransportCredentials(insecure.NewCredentials()),
+			grpc.WithUserAgent("telui"))
+		if err != nil {
+			return nil, err
+		}
+	case "http", "https":
+		c.http = &http.Client{}
+	default:
+		return nil, fmt.Errorf("invalid OTLP endpoint %q: scheme must be grpc, http or https", endpoint)
+	}
+	return c, nil
+}
+
+func (c *otlpClient) close() {
+	if c.conn != nil {
+		c.conn.Close()
+	}
+}
+
+// The headers are sent in addition to those of the client
+func (c *otlpClient) export(ctx context.Context, req exportRequest, headers map[string]string) error {
+	if c.conn != nil {
+		return c.exportGrpc(ctx, req, headers)
+	}
+	return c.exportHttp(ctx, req, headers)
+}
+
+func (c *otlpClient) exportGrpc(ctx context.Context, req exportRequest, headers map[string]string) error {
+	var opts []grpc.CallOption
+	if c.compression != "" {
+		opts = append(opts, grpc.UseCompressor(c.compression))
+	}
+	for k, v := range c.headers {
+		if _, ok := headers[k]; !ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+		}
+	}
+	for k, v := range headers {
+		ctx = metadata.AppendToOutgoingContext(ctx, k, v)
+	}
+	var err error
+	switch req := req.(type) {
+	case *ptraceotlp.ExportRequest:
+		_, err = ptraceotlp.NewGRPCClient(c.conn).Export(ctx, *req, opts...)
+	case *plogotlp.ExportRequest:
+		_, err = plogotlp.NewGRPCClient(c.conn).Export(ctx, *req, opts...)
+	case *pmetricotlp.ExportRequest:
+		_, err = pmetricotlp.NewGRPCClient(c.conn).Export(ctx, *req, opts...)
+	case *pprofileotlp.ExportRequest:
+		_, err = pprofileotlp.NewGRPCClient(c.conn).Export(ctx, *req, opts...)
+	}
+	return err
+}
+
+func (c *otlpClient) exportHttp(ctx context.Context, req exportRequest, headers map[string]string) error {
+	body, err := req.MarshalProto()
+	if err != nil {
+		return err
+	}
+	if c.compression == "gzip" {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return err
+		}
+		if err := w.Close(); err != nil {
+			return err
+		}
+		body = buf.Bytes()
+	}
+
+	hreq, err := http.NewRequestWithContext(ctx, http.MethodPost, c.endpoint+otlpHttpPaths[requestSignal(req)], bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	hreq.Header.Set("Content-Type", "application/x-protobuf")
+	hreq.Header.Set("User-Agent", "telui")
+	if c.compression != "" {
+		hreq.Header.Set("Content-Encoding", c.compression)
+	}
+	for k, v := range c.headers {
+		hreq.Header.Set(k, v)
+	}
+	for k, v := range headers {
+		hreq.Header.Set(k, v)
+	}
+	res, err := c.http.Do(hreq)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	_, _ = io.Copy(io.Discard, res.Body)
+	if res.StatusCode < 200 || res.StatusCode >= 300 {
+		return exportStatusError{code: res.StatusCode, status: res.Status}
+	}
+	return nil
+}
+
+type exportStatusError struct {
+	code   int
+	status string
+}
+
+func (e exportStatusError) Error() string {
+	return "OTLP endpoint returned " + e.status
+}
+
+// Follows the OTLP specification on which failures may be retried
+func retryableExportError(err error) bool {
+	var se exportStatusError
+	if errors.As(err, &se) {
+		switch se.code {
+		case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+			return true
+		}
+		return false
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Canceled, codes.DeadlineExceeded, codes.Aborted, codes.OutOfRange,
+			codes.Unavailable, codes.DataLoss, codes.ResourceExhausted:
+			return true
+		}
+		return false
+	}
+	return true
+}
@@ -0,0 +1,19 @@
+package server
+
+import "testing"
+
+func TestOtlpClientCompression(t *testing.T) {
+	for _, compression := range []string{"", "none", "gzip"} {
+		c, err := newOtlpClient("http://127.0.0.1:4318", nil, compression)
+		if err != nil {
+			t.Errorf("compression %q: %v", compression, err)
+			continue
+		}
+		if compression != "gzip" && c.compression != "" {
+			t.Errorf("compression %q is used as %q, want none", compression, c.compression)
+		}
+	}
+	if _, err := newOtlpClient("http://127.0.0.1:4318", nil, "zstd"); err == nil {
+		t.Error("unsupported compression zstd was accepted")
+	}
+}
@@ -0,0 +1,158 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+)
+
+const (
+	forwardTimeout     = 10 * time.Second
+	forwardMinBackoff  = time.Second
+	forwardMaxBackoff  = 30 * time.Second
+	forwardMaxAttempts = 10
+)
+
+type forwarder struct {
+	client  *otlpClient
+	redact  *redactor
+	queue   chan forwardItem
+	done    chan struct{}
+	stopped chan struct{}
+
+	mutex   sync.Mutex
+	dropped int
+	pending int // queued or being sent
+}
+
+type forwardItem struct {
+	req     exportRequest
+	headers map[string]string // in addition to the configured headers
+}
+
+func newForwarder(client *otlpClient, queueSize int) *forwarder {
+	f := &forwarder{
+		client:  client,
+		queue:   make(chan forwardItem, queueSize),
+		done:    make(chan struct{}),
+		stopped: make(chan struct{}),
+	}
+	go f.run()
+	return f
+}
+
+// Does nothing if forwarding is disabled
+func (f *forwarder) enqueue(req exportRequest, headers map[string]string) {
+	if f == nil {
+		return
+	}
+	f.redact.export(req)
+	f.mutex.Lock()
+	f.pending++
+	f.mutex.Unlock()
+	select {
+	case f.queue <- forwardItem{req, headers}:
+	default:
+		f.mutex.Lock()
+		f.pending--
+		f.mutex.Unlock()
+		f.drop(req, "queue is full")
+	}
+}
+
+func (f *forwarder) drop(req exportRequest, reason string) {
+	f.mutex.Lock()
+	f.dropped++
+	dropped := f.dropped
+	f.mutex.Unlock()
+	fmt.Fprintf(os.Stderr, "Dropped forwarded %s (%d dropped so far): %s\n", requestSignal(req), dropped, reason)
+}
+
+func (f *forwarder) run() {
+	defer close(f.stopped)
+	for {
+		select {
+		case item := <-f.queue:
+			f.send(item.req, item.headers)
+			f.mutex.Lock()
+			f.pending--
+			f.mutex.Unlock()
+		case <-f.done:
+			return
+		}
+	}
+}
+
+// Retries with exponential backoff until the batch is accepted, rejected permanently,
+// or we give up
+func (f *forwarder) send(req exportRequest, headers map[string]string) {
+	backoff := forwardMinBackoff
+	for attempt := 1; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), forwardTimeout)
+		err := f.client.export(ctx, req, headers)
+		cancel()
+		if err == nil {
+			return
+		}
+		if !retryableExportError(err) {
+			f.drop(req, err.Error())
+			return
+		}
+		if attempt == forwardMaxAttempts {
+			f.drop(req, fmt.Sprintf("%v (gave up after %d attempts)", err, attempt))
+			return
+		}
+		select {
+		case <-time.After(backoff):
+		case <-f.done:
+			f.drop(req, "shutting down")
+			return
+		}
+		backoff = min(2*backoff, forwardMaxBackoff)
+	}
+}
+
+// Waits until the queue is empty, or ctx expires
+func (f *forwarder) drain(ctx context.Context) {
+	if f == nil {
+		return
+	}
+	ticker := time.NewTicker(50 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		f.mutex.Lock()
+		idle := f.pending == 0
+		f.mutex.Unlock()
+		if idle {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (f *forwarder) stop() {
+	close(f.done)
+	<-f.stopped
+	f.client.close()
+	if n := len(f.queue); n > 0 {
+		fmt.Fprintf(os.Stderr, "Dropped %d queued batches that were not forwarded\n", n)
+	}
+}
+
+func startForwarding(st *storage, endpoint string, headers map[string]string, compression string, queueSize int) (stopFunc, error) {
+	client, err := newOtlpClient(endpoint, headers, compression)
+	if err != nil {
+		return nil, err
+	}
+	f := newForwarder(client, queueSize)
+	f.redact = st.redact
+	st.forward = f
+	fmt.Fprintf(st.messages, "Forwarding received telemetry to %s\n", endpoint)
+	return f.stop, nil
+}
@@ -0,0 +1,81 @@
+package server
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+)
+
+type forwardedRequest struct {
+	header http.Header
+	logs   plogotlp.ExportRequest
+}
+
+// An OTLP/HTTP endpoint which accepts logs, and sends them to the channel
+func testUpstream(t *testing.T) (string, chan forwardedRequest) {
+	t.Helper()
+	received := make(chan forwardedRequest, 10)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			body = zr
+		}
+		data, err := io.ReadAll(body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		req := plogotlp.NewExportRequest()
+		if r.URL.Path != "/v1/logs" || req.UnmarshalProto(data) != nil {
+			http.Error(w, "bad request", http.StatusBadRequest)
+			return
+		}
+		received <- forwardedRequest{r.Header.Clone(), req}
+	}))
+	t.Cleanup(srv.Close)
+	return srv.URL, received
+}
+
+func forwarded(t *testing.T, received chan forwardedRequest) forwardedRequest {
+	t.Helper()
+	select {
+	case fr := <-received:
+		return fr
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was forwarded")
+		return forwardedRequest{}
+	}
+}
+
+func TestForwarding(t *testing.T) {
+	url, received := testUpstream(t)
+	st := testStorage(false)
+	stop, err := startForwarding(st, url, map[string]string{"X-Api-Key": "secret"}, "gzip", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop.stop()
+
+	req := plogotlp.NewExportRequestFromLogs(testLogs("checkout", "hello"))
+	st.forward.enqueue(&req, nil)
+	fr := forwarded(t, received)
+	if got := fr.header.Get("X-Api-Key"); got != "secret" {
+		t.Errorf("X-Api-Key = %q, want the configured header", got)
+	}
+	if got := fr.header.Get("Content-Encoding"); got != "gzip" {
+		t.Errorf("Content-Encoding = %q, want gzip", got)
+	}
+	if n := fr.logs.Logs().LogRecordCount(); n != 1 {
+		t.Errorf("forwarded %d logs, want 1", n)
+	}
+}
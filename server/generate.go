@@ -0,0 +1,547 @@
+package server
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"slices"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+const (
+	generateTick    = 100 * time.Millisecond
+	generateMetrics = 10 // ticks between metric exports
+	generateScope   = "github.com/jade-guiton/telui/generate"
+)
+
+var generateBounds = []float64{5, 10, 25, 50, 100, 250, 500, 1000}
+var generateQuantiles = []float64{0.5, 0.9, 0.99}
+
+type genOp struct {
+	service string
+	name    string
+	kind    ptrace.SpanKind
+	latency time.Duration // time spent in the operation itself
+	errRate float64
+	attrs   map[string]string
+	calls   []*genOp
+}
+
+func genDb(service string, statement string) *genOp {
+	return &genOp{
+		service: service,
+		name:    statement,
+		kind:    ptrace.SpanKindClient,
+		latency: 3 * time.Millisecond,
+		errRate: 0.01,
+		attrs:   map[string]string{"db.system": "postgresql", "db.query.text": statement},
+	}
+}
+
+var genCatalogList = &genOp{
+	service: "product-catalog", name: "ListProducts", kind: ptrace.SpanKindServer,
+	latency: 2 * time.Millisecond,
+	attrs:   map[string]string{"rpc.system": "grpc", "rpc.service": "ProductCatalogService"},
+	calls:   []*genOp{genDb("product-catalog", "SELECT * FROM products")},
+}
+var genCatalogGet = &genOp{
+	service: "product-catalog", name: "GetProduct", kind: ptrace.SpanKindServer,
+	latency: time.Millisecond,
+	attrs:   map[string]string{"rpc.system": "grpc", "rpc.service": "ProductCatalogService"},
+	calls:   []*genOp{genDb("product-catalog", "SELECT * FROM products WHERE id = $1")},
+}
+var genCart = &genOp{
+	service: "cart", name: "GetCart", kind: ptrace.SpanKindServer,
+	latency: time.Millisecond, errRate: 0.02,
+	attrs: map[string]string{"rpc.system": "grpc", "rpc.service": "CartService"},
+	calls: []*genOp{{
+		service: "cart", name: "HGETALL", kind: ptrace.SpanKindClient,
+		latency: time.Millisecond,
+		attrs:   map[string]string{"db.system": "redis"},
+	}},
+}
+var genPayment = &genOp{
+	service: "payment", name: "Charge", kind: ptrace.SpanKindServer,
+	latency: 40 * time.Millisecond, errRate: 0.05,
+	attrs: map[string]string{"rpc.system": "grpc", "rpc.service": "PaymentService"},
+}
+var genEmail = &genOp{
+	service: "email", name: "SendOrderConfirmation", kind: ptrace.SpanKindServer,
+	latency: 15 * time.Millisecond,
+	attrs:   map[string]string{"rpc.system": "grpc", "rpc.service": "EmailService"},
+}
+var genCheckout = &genOp{
+	service: "checkout", name: "PlaceOrder", kind: ptrace.SpanKindServer,
+	latency: 5 * time.Millisecond,
+	attrs:   map[string]string{"rpc.system": "grpc", "rpc.service": "CheckoutService"},
+	calls: []*genOp{genCart, {
+		service: "checkout", name: "validate order", kind: ptrace.SpanKindInternal,
+		latency: 2 * time.Millisecond, errRate: 0.01,
+	}, genPayment, genDb("checkout", "INSERT INTO orders VALUES ($1, $2, $3)"), genEmail},
+}
+
+var genRoots = []*genOp{
+	{
+		service: "frontend", name: "GET /", kind: ptrace.SpanKindServer,
+		latency: 4 * time.Millisecond,
+		attrs:   map[string]string{"http.request.method": "GET", "http.route": "/"},
+		calls:   []*genOp{genCatalogList},
+	},
+	{
+		service: "frontend", name: "GET /product/{id}", kind: ptrace.SpanKindServer,
+		latency: 3 * time.Millisecond,
+		attrs:   map[string]string{"http.request.method": "GET", "http.route": "/product/{id}"},
+		calls:   []*genOp{genCatalogGet, genCart},
+	},
+	{
+		service: "frontend", name: "POST /checkout", kind: ptrace.SpanKindServer,
+		latency: 6 * time.Millisecond,
+		attrs:   map[string]string{"http.request.method": "POST", "http.route": "/checkout"},
+		calls:   []*genOp{genCheckout},
+	},
+}
+
+var genServices = map[string]string{ // service name to SDK language
+	"frontend":        "nodejs",
+	"product-catalog": "go",
+	"cart":            "dotnet",
+	"checkout":        "go",
+	"payment":         "java",
+	"email":           "python",
+}
+
+type genKey struct {
+	service string
+	op      string
+	status  string
+}
+
+type genHisto struct {
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	buckets []uint64
+	// Most recent measurement, kept as an exemplar
+	exValue float64
+	exTime  pcommon.Timestamp
+	exTrace pcommon.TraceID
+	exSpan  pcommon.SpanID
+}
+
+func (h *genHisto) record(v float64, ts pcommon.Timestamp, tid pcommon.TraceID, sid pcommon.SpanID) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(generateBounds)+1)
+		h.min = v
+		h.max = v
+	}
+	h.count++
+	h.sum += v
+	h.min = min(h.min, v)
+	h.max = max(h.max, v)
+	i, _ := slices.BinarySearch(generateBounds, v)
+	h.buckets[i]++
+	h.exValue, h.exTime, h.exTrace, h.exSpan = v, ts, tid, sid
+}
+
+type generator struct {
+	mutex   sync.Mutex
+	st      *storage // the tenant which last started generating
+	rate    float64
+	done    chan struct{}
+	stopped chan struct{}
+
+	// Only accessed by the generating goroutine
+	start    time.Time
+	counts   map[genKey]int64
+	histos   map[genKey]*genHisto
+	sizes    map[string][]float64 // request sizes per service since the last metric export
+	queries  map[string][]float64 // query durations per service since the last metric export
+	memory   map[string]float64
+	spans    ptrace.Traces
+	logs     plog.Logs
+	resSpans map[string]ptrace.SpanSlice
+	resLogs  map[string]plog.LogRecordSlice
+}
+
+func newGenerator(st *storage, rate float64) *generator {
+	return &generator{st: st, rate: rate}
+}
+
+func (g *generator) running() (bool, float64) {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.done != nil, g.rate
+}
+
+func (g *generator) tenant() string {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	return g.st.tenant
+}
+
+// Generated telemetry goes to st, which is a tenant's storage
+func (g *generator) setStorage(st *storage) {
+	g.mutex.Lock()
+	g.st = st
+	g.mutex.Unlock()
+}
+
+func (g *generator) setRate(rate float64) {
+	g.mutex.Lock()
+	g.rate = rate
+	g.mutex.Unlock()
+}
+
+func (g *generator) startGenerating() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	if g.done != nil {
+		return
+	}
+	g.done = make(chan struct{})
+	g.stopped = make(chan struct{})
+	go g.run(g.done, g.stopped)
+	if g.st.tenant != "" {
+		fmt.Fprintf(g.st.messages, "Generating %g synthetic traces per second for tenant %q\n", g.rate, g.st.tenant)
+	} else {
+		fmt.Fprintf(g.st.messages, "Generating %g synthetic traces per second\n", g.rate)
+	}
+}
+
+func (g *generator) stop() {
+	g.mutex.Lock()
+	done, stopped := g.done, g.stopped
+	g.done, g.stopped = nil, nil
+	g.mutex.Unlock()
+	if done != nil {
+		close(done)
+		<-stopped
+	}
+}
+
+func (g *generator) run(done chan struct{}, stopped chan struct{}) {
+	defer close(stopped)
+	g.start = time.Now()
+	g.counts = map[genKey]int64{}
+	g.histos = map[genKey]*genHisto{}
+	g.sizes = map[string][]float64{}
+	g.queries = map[string][]float64{}
+	g.memory = map[string]float64{}
+
+	ticker := time.NewTicker(generateTick)
+	defer ticker.Stop()
+	var pending float64
+	for tick := 1; ; tick++ {
+		select {
+		case <-ticker.C:
+		case <-done:
+			return
+		}
+		g.mutex.Lock()
+		st, rate := g.st, g.rate
+		g.mutex.Unlock()
+		pending += rate * generateTick.Seconds()
+		g.spans = ptrace.NewTraces()
+		g.logs = plog.NewLogs()
+		g.resSpans = map[string]ptrace.SpanSlice{}
+		g.resLogs = map[string]plog.LogRecordSlice{}
+		now := time.Now()
+		for ; pending >= 1; pending-- {
+			root := genRoots[rand.IntN(len(genRoots))]
+			var tid pcommon.TraceID
+			randomBytes(tid[:])
+			g.genSpan(root, tid, pcommon.SpanID{}, now.Add(-time.Second))
+		}
+		req := requestMeta{transport: "generate"}
+		if g.spans.SpanCount() > 0 {
+			st.receiveTraces(g.spans, req, payload{})
+		}
+		if g.logs.LogRecordCount() > 0 {
+			st.receiveLogs(g.logs, req, payload{})
+		}
+		if tick%generateMetrics == 0 {
+			st.receiveMetrics(g.genMetrics(now), req, payload{})
+		}
+	}
+}
+
+func setGenResource(res pcommon.Resource, service string) {
+	res.Attributes().PutStr("service.name", service)
+	res.Attributes().PutStr("service.version", "1.4.2")
+	res.Attributes().PutStr("deployment.environment.name", "demo")
+	res.Attributes().PutStr("telemetry.sdk.name", "opentelemetry")
+	res.Attributes().PutStr("telemetry.sdk.language", genServices[service])
+}
+
+func (g *generator) spanSlice(service string) ptrace.SpanSlice {
+	ss, ok := g.resSpans[service]
+	if !ok {
+		rs := g.spans.ResourceSpans().AppendEmpty()
+		setGenResource(rs.Resource(), service)
+		scs := rs.ScopeSpans().AppendEmpty()
+		scs.Scope().SetName(generateScope)
+		ss = scs.Spans()
+		g.resSpans[service] = ss
+	}
+	return ss
+}
+
+func (g *generator) log(service string, sp ptrace.Span, ts time.Time, sev plog.SeverityNumber, body string) {
+	lrs, ok := g.resLogs[service]
+	if !ok {
+		rl := g.logs.ResourceLogs().AppendEmpty()
+		setGenResource(rl.Resource(), service)
+		scl := rl.ScopeLogs().AppendEmpty()
+		scl.Scope().SetName(generateScope)
+		lrs = scl.LogRecords()
+		g.resLogs[service] = lrs
+	}
+	lr := lrs.AppendEmpty()
+	lr.SetTimestamp(pcommon.NewTimestampFromTime(ts))
+	lr.SetObservedTimestamp(pcommon.NewTimestampFromTime(ts))
+	lr.SetSeverityNumber(sev)
+	lr.SetSeverityText(sev.String())
+	lr.Body().SetStr(body)
+	lr.SetTraceID(sp.TraceID())
+	lr.SetSpanID(sp.SpanID())
+}
+
+func jitter(d time.Duration) time.Duration {
+	return time.Duration(float64(d) * (0.5 + rand.ExpFloat64()))
+}
+
+// Generates the span for `op` and its descendants, returning the span's end time and whether it failed
+func (g *generator) genSpan(op *genOp, tid pcommon.TraceID, parent pcommon.SpanID, start time.Time) (time.Time, bool) {
+	sp := g.spanSlice(op.service).AppendEmpty()
+	var sid pcommon.SpanID
+	randomBytes(sid[:])
+	sp.SetTraceID(tid)
+	sp.SetSpanID(sid)
+	sp.SetParentSpanID(parent)
+	sp.SetName(op.name)
+	sp.SetKind(op.kind)
+	for k, v := range op.attrs {
+		sp.Attributes().PutStr(k, v)
+	}
+
+	t := start.Add(jitter(op.latency / 4))
+	failed := false
+	for _, call := range op.calls {
+		if call.kind != ptrace.SpanKindServer {
+			var callFailed bool
+			t, callFailed = g.genSpan(call, tid, sid, t)
+			failed = failed || callFailed
+			continue
+		}
+		// Remote call: client span in this service, server span in the callee
+		client := g.spanSlice(op.service).AppendEmpty()
+		var csid pcommon.SpanID
+		randomBytes(csid[:])
+		client.SetTraceID(tid)
+		client.SetSpanID(csid)
+		client.SetParentSpanID(sid)
+		client.SetName(call.name)
+		client.SetKind(ptrace.SpanKindClient)
+		client.Attributes().PutStr("server.address", call.service)
+		client.SetStartTimestamp(pcommon.NewTimestampFromTime(t))
+		end, callFailed := g.genSpan(call, tid, csid, t.Add(jitter(300*time.Microsecond)))
+		t = end.Add(jitter(300 * time.Microsecond))
+		client.SetEndTimestamp(pcommon.NewTimestampFromTime(t))
+		if callFailed {
+			client.Status().SetCode(ptrace.StatusCodeError)
+			failed = true
+		}
+	}
+	end := t.Add(jitter(op.latency))
+	if rand.Float64() < op.errRate {
+		failed = true
+		sp.Status().SetCode(ptrace.StatusCodeError)
+		sp.Status().SetMessage(op.name + " failed")
+		ev := sp.Events().AppendEmpty()
+		ev.SetName("exception")
+		ev.SetTimestamp(pcommon.NewTimestampFromTime(end))
+		ev.Attributes().PutStr("exception.type", "TimeoutError")
+		ev.Attributes().PutStr("exception.message", "deadline exceeded while waiting for "+op.name)
+	} else if failed {
+		sp.Status().SetCode(ptrace.StatusCodeError)
+	}
+	sp.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	sp.SetEndTimestamp(pcommon.NewTimestampFromTime(end))
+
+	status := "ok"
+	if failed {
+		status = "error"
+	}
+	durationMs := float64(end.Sub(start)) / float64(time.Millisecond)
+	switch op.kind {
+	case ptrace.SpanKindServer:
+		key := genKey{op.service, op.name, status}
+		g.counts[key]++
+		h, ok := g.histos[key]
+		if !ok {
+			h = &genHisto{}
+			g.histos[key] = h
+		}
+		h.record(durationMs, sp.EndTimestamp(), tid, sid)
+		g.sizes[op.service] = append(g.sizes[op.service], math.Round(200+rand.ExpFloat64()*2000))
+		if failed {
+			g.log(op.service, sp, end, plog.SeverityNumberError, fmt.Sprintf("%s failed after %.1f ms", op.name, durationMs))
+		} else {
+			g.log(op.service, sp, end, plog.SeverityNumberInfo, fmt.Sprintf("%s handled in %.1f ms", op.name, durationMs))
+		}
+	case ptrace.SpanKindClient:
+		if _, ok := op.attrs["db.system"]; ok {
+			g.queries[op.service] = append(g.queries[op.service], durationMs)
+			g.log(op.service, sp, start, plog.SeverityNumberDebug, "executing "+op.name)
+		}
+	}
+	return end, failed
+}
+
+func (g *generator) genMetrics(now time.Time) pmetric.Metrics {
+	md := pmetric.NewMetrics()
+	startTs := pcommon.NewTimestampFromTime(g.start)
+	nowTs := pcommon.NewTimestampFromTime(now)
+	prevTs := pcommon.NewTimestampFromTime(now.Add(-generateMetrics * generateTick))
+
+	services := make([]string, 0, len(genServices))
+	for service := range genServices {
+		services = append(services, service)
+	}
+	slices.Sort(services)
+	for _, service := range services {
+		rm := md.ResourceMetrics().AppendEmpty()
+		setGenResource(rm.Resource(), service)
+		sm := rm.ScopeMetrics().AppendEmpty()
+		sm.Scope().SetName(generateScope)
+
+		count := sm.Metrics().AppendEmpty()
+		count.SetName("app.request.count")
+		count.SetUnit("{request}")
+		count.SetDescription("Number of requests handled")
+		sum := count.SetEmptySum()
+		sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+		sum.SetIsMonotonic(true)
+
+		duration := sm.Metrics().AppendEmpty()
+		duration.SetName("app.request.duration")
+		duration.SetUnit("ms")
+		duration.SetDescription("Duration of handled requests")
+		histo := duration.SetEmptyHistogram()
+		histo.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+
+		for key, n := range g.counts {
+			if key.service != service {
+				continue
+			}
+			dp := sum.DataPoints().AppendEmpty()
+			dp.Attributes().PutStr("operation", key.op)
+			dp.Attributes().PutStr("status", key.status)
+			dp.SetStartTimestamp(startTs)
+			dp.SetTimestamp(nowTs)
+			dp.SetIntValue(n)
+
+			h := g.histos[key]
+			hdp := histo.DataPoints().AppendEmpty()
+			hdp.Attributes().PutStr("operation", key.op)
+			hdp.Attributes().PutStr("status", key.status)
+			hdp.SetStartTimestamp(startTs)
+			hdp.SetTimestamp(nowTs)
+			hdp.SetCount(h.count)
+			hdp.SetSum(h.sum)
+			hdp.SetMin(h.min)
+			hdp.SetMax(h.max)
+			hdp.ExplicitBounds().FromRaw(generateBounds)
+			hdp.BucketCounts().FromRaw(h.buckets)
+			ex := hdp.Exemplars().AppendEmpty()
+			ex.SetTimestamp(h.exTime)
+			ex.SetDoubleValue(h.exValue)
+			ex.SetTraceID(h.exTrace)
+			ex.SetSpanID(h.exSpan)
+		}
+
+		mem := g.memory[service]
+		if mem == 0 {
+			mem = 50e6 + rand.Float64()*100e6
+		}
+		mem = max(20e6, mem+rand.NormFloat64()*2e6)
+		g.memory[service] = mem
+		memory := sm.Metrics().AppendEmpty()
+		memory.SetName("process.memory.usage")
+		memory.SetUnit("By")
+		memory.SetDescription("The amount of physical memory in use")
+		gdp := memory.SetEmptyGauge().DataPoints().AppendEmpty()
+		gdp.SetTimestamp(nowTs)
+		gdp.SetIntValue(int64(mem))
+
+		size := sm.Metrics().AppendEmpty()
+		size.SetName("app.request.size")
+		size.SetUnit("By")
+		size.SetDescription("Size of request bodies")
+		ehdp := size.SetEmptyExponentialHistogram()
+		ehdp.SetAggregationTemporality(pmetric.AggregationTemporalityDelta)
+		edp := ehdp.DataPoints().AppendEmpty()
+		edp.SetStartTimestamp(prevTs)
+		edp.SetTimestamp(nowTs)
+		setExponentialBuckets(edp, g.sizes[service])
+		g.sizes[service] = nil
+
+		if queries := g.queries[service]; len(queries) > 0 {
+			query := sm.Metrics().AppendEmpty()
+			query.SetName("app.db.query.duration")
+			query.SetUnit("ms")
+			query.SetDescription("Duration of database queries")
+			sdp := query.SetEmptySummary().DataPoints().AppendEmpty()
+			sdp.SetStartTimestamp(prevTs)
+			sdp.SetTimestamp(nowTs)
+			slices.Sort(queries)
+			sdp.SetCount(uint64(len(queries)))
+			var total float64
+			for _, q := range queries {
+				total += q
+			}
+			sdp.SetSum(total)
+			for _, q := range generateQuantiles {
+				qv := sdp.QuantileValues().AppendEmpty()
+				qv.SetQuantile(q)
+				qv.SetValue(queries[int(q*float64(len(queries)-1))])
+			}
+			g.queries[service] = nil
+		}
+	}
+	return md
+}
+
+// Uses scale 0, so bucket i holds values in (2^i, 2^(i+1)]
+func setExponentialBuckets(dp pmetric.ExponentialHistogramDataPoint, values []float64) {
+	dp.SetScale(0)
+	dp.SetCount(uint64(len(values)))
+	if len(values) == 0 {
+		return
+	}
+	var sum float64
+	minIdx, maxIdx := math.MaxInt, math.MinInt
+	idxs := make([]int, len(values))
+	for i, v := range values {
+		sum += v
+		idxs[i] = int(math.Ceil(math.Log2(v))) - 1
+		minIdx = min(minIdx, idxs[i])
+		maxIdx = max(maxIdx, idxs[i])
+	}
+	buckets := make([]uint64, maxIdx-minIdx+1)
+	for _, idx := range idxs {
+		buckets[idx-minIdx]++
+	}
+	dp.SetSum(sum)
+	dp.SetMin(slices.Min(values))
+	dp.SetMax(slices.Max(values))
+	dp.Positive().SetOffset(int32(minIdx))
+	dp.Positive().BucketCounts().FromRaw(buckets)
+}
@@ -0,0 +1,37 @@
+package server
+
+import (
+	"net/http"
+)
+
+// Serves /healthz and /readyz in front of h. They are answered before h so that
+// health checks do not show up in self-telemetry.
+//
+// /healthz succeeds as long as the process is up; /readyz only once all
+// endpoints are started, and not anymore once telui is stopping.
+func withHealth(st *storage, h http.Handler) http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("ok\n"))
+	})
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		if !st.ready.Load() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte("not ready\n"))
+			return
+		}
+		w.Write([]byte("ready\n"))
+	})
+	mux.Handle("/", h)
+	return mux
+}
+
+// Sets whether telui is ready, for /readyz and the gRPC health service
+func (st *storage) setReady(ready bool) {
+	st.ready.Store(ready)
+	for _, f := range st.readyFuncs {
+		f(ready)
+	}
+}
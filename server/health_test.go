@@ -0,0 +1,73 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+)
+
+func TestReadyz(t *testing.T) {
+	st := testStorage(false)
+	h := withHealth(st, http.NotFoundHandler())
+	get := func(path string) int {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		return w.Code
+	}
+	for _, ready := range []bool{false, true, false} {
+		st.setReady(ready)
+		want := http.StatusServiceUnavailable
+		if ready {
+			want = http.StatusOK
+		}
+		if code := get("/readyz"); code != want {
+			t.Errorf("ready = %v: /readyz returned %d, want %d", ready, code, want)
+		}
+		if code := get("/healthz"); code != http.StatusOK {
+			t.Errorf("ready = %v: /healthz returned %d, want 200", ready, code)
+		}
+	}
+}
+
+func TestGrpcHealth(t *testing.T) {
+	st := testStorage(false)
+	drain, port, err := serveOtlpGrpc(st, "127.0.0.1", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer drain(context.Background())
+	conn, err := grpc.NewClient("127.0.0.1:"+strconv.Itoa(port), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	client := healthpb.NewHealthClient(conn)
+	check := func(service string) healthpb.HealthCheckResponse_ServingStatus {
+		res, err := client.Check(context.Background(), &healthpb.HealthCheckRequest{Service: service})
+		if err != nil {
+			t.Fatalf("checking %q: %v", service, err)
+		}
+		return res.Status
+	}
+
+	const logs = "opentelemetry.proto.collector.logs.v1.LogsService"
+	for _, ready := range []bool{false, true, false} {
+		st.setReady(ready)
+		want := healthpb.HealthCheckResponse_NOT_SERVING
+		if ready {
+			want = healthpb.HealthCheckResponse_SERVING
+		}
+		if got := check(logs); got != want {
+			t.Errorf("ready = %v: %s is %v, want %v", ready, logs, got, want)
+		}
+		if got := check(""); got != healthpb.HealthCheckResponse_SERVING {
+			t.Errorf("ready = %v: the server is %v, want SERVING", ready, got)
+		}
+	}
+}
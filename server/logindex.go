@@ -0,0 +1,51 @@
+package server
+
+import "slices"
+
+// The logs of each trace, to show them with its spans. The index must be used
+// with the storage locked.
+
+func (st *storage) indexLog(l log) {
+	if l.trace.notEmpty() {
+		st.traceLogs[l.trace] = append(st.traceLogs[l.trace], l.id)
+	}
+}
+
+func (st *storage) unindexLog(l log) {
+	ids := slices.DeleteFunc(st.traceLogs[l.trace], func(id int) bool { return id == l.id })
+	if len(ids) == 0 {
+		delete(st.traceLogs, l.trace)
+	} else {
+		st.traceLogs[l.trace] = ids
+	}
+}
+
+func (st *storage) reindexLogs() {
+	st.traceLogs = map[traceId][]int{}
+	for _, l := range st.logs {
+		st.indexLog(l)
+	}
+}
+
+// Returns the logs of a trace, in order, or only those of one of its spans if
+// sid is not empty
+func (st *storage) logsOf(tid traceId, sid spanId) []log {
+	var logs []log
+	for _, id := range st.traceLogs[tid] {
+		i, ok := st.logIndex(id)
+		if ok && (!sid.notEmpty() || st.logs[i].span == sid) {
+			logs = append(logs, st.logs[i])
+		}
+	}
+	return logs
+}
+
+func logListItem(a *arrayifier, l log) {
+	m := a.submap()
+	defer m.done()
+	m.pair("id", intValue(l.id))
+	if l.span.notEmpty() {
+		m.pair("span", stringValue(l.span.toString()))
+	}
+	l.logSummary.toJson(&m)
+}
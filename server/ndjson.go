@@ -0,0 +1,318 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Writes one self-contained JSON object per received span, log and metric
+// point, with the resource and scope inlined. Unlike the UI API, values are
+// plain JSON (RFC 3339 timestamps, hex IDs) so the output is easy to use with jq.
+type ndjsonWriter struct {
+	mutex  sync.Mutex
+	w      *bufio.Writer
+	file   io.Closer
+	failed bool
+}
+
+type ndjsonResource struct {
+	Attributes map[string]any `json:"attributes,omitempty"`
+	SchemaUrl  string         `json:"schemaUrl,omitempty"`
+}
+
+type ndjsonScope struct {
+	Name       string         `json:"name,omitempty"`
+	Version    string         `json:"version,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+type ndjsonEvent struct {
+	Name       string         `json:"name"`
+	Time       string         `json:"time,omitempty"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+type ndjsonLink struct {
+	TraceId    string         `json:"traceId"`
+	SpanId     string         `json:"spanId"`
+	Attributes map[string]any `json:"attributes,omitempty"`
+}
+
+type ndjsonSpan struct {
+	Signal        string         `json:"signal"`
+	TraceId       string         `json:"traceId"`
+	SpanId        string         `json:"spanId"`
+	ParentSpanId  string         `json:"parentSpanId,omitempty"`
+	Name          string         `json:"name"`
+	Kind          string         `json:"kind"`
+	Start         string         `json:"start,omitempty"`
+	End           string         `json:"end,omitempty"`
+	DurationMs    float64        `json:"durationMs"`
+	Status        string         `json:"status,omitempty"`
+	StatusMessage string         `json:"statusMessage,omitempty"`
+	Attributes    map[string]any `json:"attributes,omitempty"`
+	Events        []ndjsonEvent  `json:"events,omitempty"`
+	Links         []ndjsonLink   `json:"links,omitempty"`
+	Resource      ndjsonResource `json:"resource"`
+	Scope         ndjsonScope    `json:"scope"`
+	Tenant        string         `json:"tenant,omitempty"`
+}
+
+type ndjsonLog struct {
+	Signal       string         `json:"signal"`
+	Time         string         `json:"time,omitempty"`
+	ObservedTime string         `json:"observedTime,omitempty"`
+	Severity     string         `json:"severity,omitempty"`
+	SeverityText string         `json:"severityText,omitempty"`
+	EventName    string         `json:"eventName,omitempty"`
+	Body         any            `json:"body,omitempty"`
+	Attributes   map[string]any `json:"attributes,omitempty"`
+	TraceId      string         `json:"traceId,omitempty"`
+	SpanId       string         `json:"spanId,omitempty"`
+	Resource     ndjsonResource `json:"resource"`
+	Scope        ndjsonScope    `json:"scope"`
+	Tenant       string         `json:"tenant,omitempty"`
+}
+
+type ndjsonQuantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+type ndjsonPoint struct {
+	Signal       string           `json:"signal"`
+	Name         string           `json:"name"`
+	Type         string           `json:"type"`
+	Unit         string           `json:"unit,omitempty"`
+	Description  string           `json:"description,omitempty"`
+	Temporality  string           `json:"temporality,omitempty"`
+	Monotonic    *bool            `json:"monotonic,omitempty"`
+	Time         string           `json:"time,omitempty"`
+	StartTime    string           `json:"startTime,omitempty"`
+	Attributes   map[string]any   `json:"attributes,omitempty"`
+	Value        any              `json:"value,omitempty"`
+	Count        *uint64          `json:"count,omitempty"`
+	Sum          *float64         `json:"sum,omitempty"`
+	Min          *float64         `json:"min,omitempty"`
+	Max          *float64         `json:"max,omitempty"`
+	Bounds       []float64        `json:"bounds,omitempty"`
+	BucketCounts []uint64         `json:"bucketCounts,omitempty"`
+	Quantiles    []ndjsonQuantile `json:"quantiles,omitempty"`
+	Resource     ndjsonResource   `json:"resource"`
+	Scope        ndjsonScope      `json:"scope"`
+	Tenant       string           `json:"tenant,omitempty"`
+}
+
+func ndjsonTime(t timestampValue) string {
+	if t == 0 {
+		return ""
+	}
+	return time.Unix(0, int64(t)).UTC().Format(time.RFC3339Nano)
+}
+
+func ndjsonAttr(attr mapValue) map[string]any {
+	if !attr.notEmpty() {
+		return nil
+	}
+	return attr.toGo()
+}
+
+func ndjsonId(id []byte) string {
+	for _, b := range id {
+		if b != 0 {
+			return fmt.Sprintf("%x", id)
+		}
+	}
+	return ""
+}
+
+// Must be called with the storage locked
+func (st *storage) ndjsonOrigin(res resId, sc scopeId) (ndjsonResource, ndjsonScope) {
+	r := st.resources[res]
+	s := st.scopes[sc]
+	return ndjsonResource{
+		Attributes: ndjsonAttr(r.attr),
+		SchemaUrl:  r.schema,
+	}, ndjsonScope{
+		Name:       s.name,
+		Version:    s.version,
+		Attributes: ndjsonAttr(s.attr),
+	}
+}
+
+func (nw *ndjsonWriter) write(record any) {
+	if nw == nil {
+		return
+	}
+	b, err := json.Marshal(record)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to encode NDJSON record: %v\n", err)
+		return
+	}
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+	if nw.failed {
+		return
+	}
+	nw.w.Write(b)
+	if err := nw.w.WriteByte('\n'); err != nil {
+		nw.failed = true
+		fmt.Fprintf(os.Stderr, "Failed to write NDJSON output, disabling it: %v\n", err)
+	}
+}
+
+func (nw *ndjsonWriter) span(st *storage, tid traceId, sid spanId, sp span) {
+	if nw == nil {
+		return
+	}
+	rec := ndjsonSpan{
+		Signal:        "span",
+		TraceId:       ndjsonId(tid[:]),
+		SpanId:        ndjsonId(sid[:]),
+		ParentSpanId:  ndjsonId(sp.parent[:]),
+		Name:          sp.name,
+		Kind:          sp.kind,
+		Start:         ndjsonTime(sp.start),
+		End:           ndjsonTime(sp.end),
+		Status:        sp.status,
+		StatusMessage: sp.statusMsg,
+		Attributes:    ndjsonAttr(sp.attr),
+	}
+	if sp.end > sp.start {
+		rec.DurationMs = float64(sp.end-sp.start) / 1e6
+	}
+	for _, e := range sp.events {
+		rec.Events = append(rec.Events, ndjsonEvent{e.name, ndjsonTime(e.time), ndjsonAttr(e.attr)})
+	}
+	for _, l := range sp.links {
+		rec.Links = append(rec.Links, ndjsonLink{ndjsonId(l.trace[:]), ndjsonId(l.span[:]), ndjsonAttr(l.attr)})
+	}
+	st.Lock()
+	rec.Resource, rec.Scope = st.ndjsonOrigin(sp.res, sp.scope)
+	rec.Tenant = st.tenant
+	st.Unlock()
+	nw.write(rec)
+}
+
+func (nw *ndjsonWriter) log(st *storage, l log) {
+	if nw == nil {
+		return
+	}
+	rec := ndjsonLog{
+		Signal:       "log",
+		Time:         ndjsonTime(l.time),
+		ObservedTime: ndjsonTime(l.timeObs),
+		Severity:     l.sev,
+		SeverityText: l.sevText,
+		EventName:    l.event,
+		Attributes:   ndjsonAttr(l.attr),
+		TraceId:      ndjsonId(l.trace[:]),
+		SpanId:       ndjsonId(l.span[:]),
+	}
+	if l.body != nil {
+		rec.Body = toGo(l.body)
+	}
+	st.Lock()
+	rec.Resource, rec.Scope = st.ndjsonOrigin(l.res, l.scope)
+	rec.Tenant = st.tenant
+	st.Unlock()
+	nw.write(rec)
+}
+
+func (nw *ndjsonWriter) point(st *storage, m *metric, attr mapValue, pt pointlike) {
+	if nw == nil {
+		return
+	}
+	p := pt.getPoint()
+	rec := ndjsonPoint{
+		Signal:      "metric",
+		Name:        m.name,
+		Type:        m.type_,
+		Unit:        m.unit,
+		Temporality: m.tempo,
+		Time:        ndjsonTime(p.time),
+		StartTime:   ndjsonTime(p.timeStart),
+		Attributes:  ndjsonAttr(attr),
+	}
+	if m.type_ == "Sum" {
+		rec.Monotonic = &m.mono
+	}
+	histolike := func(hlp histolikePoint) {
+		rec.Count = &hlp.count
+		if hlp.has.sum {
+			rec.Sum = &hlp.sum
+		}
+		if hlp.has.min {
+			rec.Min = &hlp.min
+		}
+		if hlp.has.max {
+			rec.Max = &hlp.max
+		}
+	}
+	switch pt := pt.(type) {
+	case numberPoint:
+		if pt.value != nil {
+			rec.Value = toGo(pt.value)
+		}
+	case histogramPoint:
+		histolike(pt.histolikePoint)
+		rec.Bounds = pt.bounds
+		rec.BucketCounts = pt.buckets
+	case exponentialHistogramPoint:
+		histolike(pt.histolikePoint)
+	case summaryPoint:
+		rec.Count = &pt.count
+		rec.Sum = &pt.sum
+		for _, q := range pt.quantiles {
+			rec.Quantiles = append(rec.Quantiles, ndjsonQuantile{q.q, q.v})
+		}
+	}
+	st.Lock()
+	rec.Description = m.desc
+	rec.Resource, rec.Scope = st.ndjsonOrigin(m.res, m.scope)
+	rec.Tenant = st.tenant
+	st.Unlock()
+	nw.write(rec)
+}
+
+// Called after each request, so that tailing the output shows data promptly
+func (nw *ndjsonWriter) flush() {
+	if nw == nil {
+		return
+	}
+	nw.mutex.Lock()
+	defer nw.mutex.Unlock()
+	if !nw.failed {
+		nw.w.Flush()
+	}
+}
+
+func (nw *ndjsonWriter) stop() {
+	nw.flush()
+	if nw.file != nil {
+		nw.file.Close()
+	}
+}
+
+// Writes to stdout if path is "-"
+func startNdjson(st *storage, path string) (stopFunc, error) {
+	nw := &ndjsonWriter{}
+	if path == "-" {
+		nw.w = bufio.NewWriter(os.Stdout)
+	} else {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o644)
+		if err != nil {
+			return nil, err
+		}
+		nw.w = bufio.NewWriter(f)
+		nw.file = f
+		fmt.Fprintf(st.messages, "Writing received telemetry as NDJSON to %s\n", path)
+	}
+	st.ndjson = nw
+	return nw.stop, nil
+}
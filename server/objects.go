@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"cmp"
@@ -8,8 +8,13 @@ import (
 	"hash"
 	"hash/fnv"
 	"io"
+	"maps"
+	"net"
 	"net/http"
 	"slices"
+	"strings"
+	"time"
+	"unicode/utf8"
 
 	"google.golang.org/grpc/metadata"
 	"google.golang.org/grpc/peer"
@@ -114,6 +119,23 @@ func httpRequest(r *http.Request) requestMeta {
 	return req
 }
 
+func (r requestMeta) header(name string) string {
+	for k, vs := range r.headers {
+		if strings.EqualFold(k, name) && len(vs) > 0 {
+			return vs[0]
+		}
+	}
+	return ""
+}
+
+func (r requestMeta) peerHost() string {
+	host, _, err := net.SplitHostPort(r.peer)
+	if err != nil {
+		return r.peer
+	}
+	return host
+}
+
 type kvs = struct {
 	k  string
 	vs []string
@@ -164,6 +186,145 @@ func (r requestMeta) toJson(w io.Writer) {
 	}
 }
 
+type payload struct {
+	contentType string
+	encoding    string
+	wireSize    int
+	size        int
+	decodeTime  time.Duration
+	body        []byte
+}
+
+func (p payload) toJson(m *mapifier) {
+	if p.contentType != "" {
+		m.pair("content.type", stringValue(p.contentType))
+	}
+	if p.encoding != "" {
+		m.pair("encoding", stringValue(p.encoding))
+	}
+	m.pair("size.wire", intValue(p.wireSize))
+	m.pair("size", intValue(p.size))
+	m.pair("decode", stringValue(p.decodeTime.String()))
+	m.pair("body.kept", boolValue(p.body != nil))
+}
+
+type exportCall struct {
+	payload
+	id     int // stable, unlike the index in storage.calls
+	req    reqId
+	signal string
+	time   timestampValue
+	items  map[resId]int
+}
+
+func (c exportCall) itemCount() int {
+	n := 0
+	for _, cnt := range c.items {
+		n += cnt
+	}
+	return n
+}
+
+var _ value = exportCall{}
+
+func (c exportCall) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("id", intValue(c.id))
+	m.pair("time", c.time)
+	m.pair("signal", stringValue(c.signal))
+	m.pair("req", c.req)
+	m.pair("items", intValue(c.itemCount()))
+	a := m.array("resources")
+	for _, rid := range slices.Sorted(maps.Keys(c.items)) {
+		a.item(rid)
+	}
+	a.done()
+	c.payload.toJson(&m)
+}
+
+type rejection struct {
+	req     requestMeta
+	signal  string
+	time    timestampValue
+	status  string
+	err     string
+	payload payload
+}
+
+var _ value = rejection{}
+
+func (r rejection) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("time", r.time)
+	m.pair("signal", stringValue(r.signal))
+	if r.status != "" {
+		m.pair("status", stringValue(r.status))
+	}
+	m.pair("error", stringValue(r.err))
+	m.pair("request", r.req)
+	if r.payload.contentType != "" {
+		m.pair("content.type", stringValue(r.payload.contentType))
+	}
+	if r.payload.encoding != "" {
+		m.pair("encoding", stringValue(r.payload.encoding))
+	}
+	if r.payload.size != 0 {
+		m.pair("size", intValue(r.payload.size))
+	}
+	if len(r.payload.body) > 0 {
+		m.pair("body.start", bytesValue(r.payload.body))
+		if utf8.Valid(r.payload.body) {
+			m.pair("body.start.text", stringValue(r.payload.body))
+		}
+	}
+}
+
+type client struct {
+	transport string
+	peer      string
+	userAgent string
+	attr      mapValue
+	requests  int
+	items     map[string]int
+	bytes     int
+	first     timestampValue
+	last      timestampValue
+	errors    int
+	lastError string
+}
+
+var _ value = &client{}
+
+func (c *client) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("transport", stringValue(c.transport))
+	m.pair("peer", stringValue(c.peer))
+	if c.userAgent != "" {
+		m.pair("user.agent", stringValue(c.userAgent))
+	}
+	if c.attr.notEmpty() {
+		m.pair("attr", c.attr)
+	}
+	m.pair("requests", intValue(c.requests))
+	m2 := m.submap("items")
+	for _, signal := range slices.Sorted(maps.Keys(c.items)) {
+		m2.pair(signal, intValue(c.items[signal]))
+	}
+	m2.done()
+	m.pair("bytes", intValue(c.bytes))
+	if c.first.notEmpty() {
+		m.pair("first", c.first)
+		m.pair("last", c.last)
+	}
+	m.pair("errors", intValue(c.errors))
+	if c.lastError != "" {
+		m.pair("error.last", stringValue(c.lastError))
+	}
+}
+
 type resource struct {
 	attr        mapValue
 	attrDropped uint32
@@ -234,6 +395,53 @@ type trace struct {
 
 var _ value = trace{}
 
+// Arranges the spans as a forest, where every span is reached once: spans whose
+// parent was not received are roots, and so are self-parented spans and one
+// span of each parent cycle
+func (t *trace) tree() (roots []spanId, children map[spanId][]spanId) {
+	children = map[spanId][]spanId{}
+	for sid, sp := range t.spans {
+		if _, ok := t.spans[sp.parent]; ok && sp.parent.notEmpty() && sp.parent != sid {
+			children[sp.parent] = append(children[sp.parent], sid)
+		} else {
+			roots = append(roots, sid)
+		}
+	}
+	reached := map[spanId]bool{}
+	var reach func(sid spanId)
+	reach = func(sid spanId) {
+		reached[sid] = true
+		for _, c := range children[sid] {
+			reach(c)
+		}
+	}
+	for _, sid := range roots {
+		reach(sid)
+	}
+	if len(reached) == len(t.spans) {
+		return roots, children
+	}
+	rest := slices.SortedFunc(maps.Keys(t.spans), func(s1, s2 spanId) int {
+		return strings.Compare(s1.toString(), s2.toString())
+	})
+	for _, sid := range rest {
+		if reached[sid] {
+			continue
+		}
+		// Go up to the cycle, and break it there
+		seen := map[spanId]bool{}
+		for !seen[sid] {
+			seen[sid] = true
+			sid = t.spans[sid].parent
+		}
+		parent := t.spans[sid].parent
+		children[parent] = slices.DeleteFunc(children[parent], func(c spanId) bool { return c == sid })
+		roots = append(roots, sid)
+		reach(sid)
+	}
+	return roots, children
+}
+
 func (t trace) toJson(w io.Writer) {
 	m := mapify(w)
 	defer m.done()
@@ -384,9 +592,7 @@ type logSummary struct {
 
 var _ value = log{}
 
-func (ls logSummary) toJson(w io.Writer) {
-	m := mapify(w)
-	defer m.done()
+func (ls logSummary) toJson(m *mapifier) {
 	m.pair("time", ls.simpleTime)
 	m.pair("sev", stringValue(ls.sev))
 	m.pair("body", stringValue(ls.simpleBody))
@@ -394,6 +600,7 @@ func (ls logSummary) toJson(w io.Writer) {
 
 type log struct {
 	logSummary
+	id          int // stable across deletions, unlike the index in storage.logs
 	req         reqId
 	res         resId
 	scope       scopeId
@@ -612,6 +819,18 @@ func (e exemplar) toJson(w io.Writer) {
 	}
 }
 
+func pointExemplars(pt pointlike) []exemplar {
+	switch pt := pt.(type) {
+	case numberPoint:
+		return pt.exemplars
+	case histogramPoint:
+		return pt.exemplars
+	case exponentialHistogramPoint:
+		return pt.exemplars
+	}
+	return nil
+}
+
 type histolikePoint struct {
 	point
 	count uint64
@@ -739,3 +958,145 @@ func (sp summaryPoint) toJson(w io.Writer) {
 		m2.done()
 	}
 }
+
+type profileId [16]byte
+
+func (pid profileId) notEmpty() bool {
+	return pid != profileId{}
+}
+func (pid profileId) toString() string {
+	return hex.EncodeToString(pid[:])
+}
+
+type profileSummary struct {
+	num         int // stable ID in the API, unlike the index in storage.profiles
+	simpleTime  timestampValue
+	name        string
+	sampleCount int
+}
+
+func (ps profileSummary) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("id", intValue(ps.num))
+	m.pair("time", ps.simpleTime)
+	m.pair("name", stringValue(ps.name))
+	m.pair("samples", intValue(ps.sampleCount))
+}
+
+type profile struct {
+	profileSummary
+	req         reqId
+	res         resId
+	scope       scopeId
+	id          profileId
+	time        timestampValue
+	duration    uint64
+	sampleTypes []valueType
+	defaultType int
+	periodType  valueType
+	period      int64
+	comments    []string
+	attr        mapValue
+	attrDropped uint32
+	origFormat  string
+	samples     []sample
+}
+
+var _ value = profile{}
+
+func (p profile) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("req", p.req)
+	m.pair("res", p.res)
+	m.pair("scope", p.scope)
+	if p.id.notEmpty() {
+		m.pair("id", stringValue(p.id.toString()))
+	}
+	if p.time.notEmpty() {
+		m.pair("time", p.time)
+	}
+	if p.duration != 0 {
+		m.pair("duration", uintValue(p.duration))
+	}
+	a := m.array("sample.types")
+	for _, vt := range p.sampleTypes {
+		a.item(vt)
+	}
+	a.done()
+	if p.defaultType != 0 {
+		m.pair("sample.types.default", intValue(p.defaultType))
+	}
+	if p.periodType.type_ != "" || p.period != 0 {
+		m.pair("period.type", p.periodType)
+		m.pair("period", intValue(p.period))
+	}
+	if len(p.comments) > 0 {
+		a := m.array("comments")
+		for _, c := range p.comments {
+			a.item(stringValue(c))
+		}
+		a.done()
+	}
+	if p.attr.notEmpty() {
+		m.pair("attr", p.attr)
+	}
+	if p.attrDropped != 0 {
+		m.pair("attr.dropped", intValue(p.attrDropped))
+	}
+	if p.origFormat != "" {
+		m.pair("orig.format", stringValue(p.origFormat))
+	}
+	m.pair("samples", intValue(len(p.samples)))
+}
+
+type valueType struct {
+	type_ string
+	unit  string
+	tempo string
+}
+
+func (vt valueType) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("type", stringValue(vt.type_))
+	if vt.unit != "" {
+		m.pair("unit", stringValue(vt.unit))
+	}
+	if vt.tempo != "" {
+		m.pair("tempo", stringValue(vt.tempo))
+	}
+}
+
+type sample struct {
+	stack  []string
+	values []int64
+	attr   mapValue
+	trace  traceId
+	span   spanId
+}
+
+func (s sample) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	a := m.array("stack")
+	for _, f := range s.stack {
+		a.item(stringValue(f))
+	}
+	a.done()
+	a = m.array("vals")
+	for _, v := range s.values {
+		a.item(intValue(v))
+	}
+	a.done()
+	if s.attr.notEmpty() {
+		m.pair("attr", s.attr)
+	}
+	if s.trace.notEmpty() || s.span.notEmpty() {
+		m.pair("span", traceSpanId{
+			traceId: s.trace,
+			spanId:  s.span,
+		})
+	}
+}
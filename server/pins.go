@@ -0,0 +1,139 @@
+package server
+
+import (
+	"cmp"
+	"maps"
+	"slices"
+	"strconv"
+	"time"
+)
+
+// A pinned trace, log or metric, which Reset and bulk deletions keep
+type pinKey struct {
+	kind string // "trace", "log" or "metric"
+	id   string // as in the API paths
+}
+
+type pin struct {
+	note string
+	time timestampValue
+}
+
+func (p pin) toJson(m *mapifier) {
+	if p.note != "" {
+		m.pair("note", stringValue(p.note))
+	}
+	m.pair("time", p.time)
+}
+
+func tracePin(tid traceId) pinKey {
+	return pinKey{"trace", tid.toString()}
+}
+func logPin(id int) pinKey {
+	return pinKey{"log", strconv.Itoa(id)}
+}
+func metricPin(mid hashId) pinKey {
+	return pinKey{"metric", hashToString(uint64(mid))}
+}
+
+// The pin methods must be called with the storage locked
+
+// Parses the kind and ID from an API path, returning false if there is no
+// such item
+func (st *storage) pinTarget(kind string, id string) (pinKey, bool) {
+	switch kind {
+	case "trace":
+		tid, ok := parseTraceId(id)
+		if _, found := st.traces[tid]; ok && found {
+			return tracePin(tid), true
+		}
+	case "log":
+		id, err := strconv.Atoi(id)
+		if _, found := st.logIndex(id); err == nil && found {
+			return logPin(id), true
+		}
+	case "metric":
+		mid, ok := parseHashId(id)
+		if _, found := st.metrics[hashId(mid)]; ok && found {
+			return metricPin(hashId(mid)), true
+		}
+	}
+	return pinKey{}, false
+}
+
+func (st *storage) setPin(key pinKey, note string) {
+	p, ok := st.pins[key]
+	if !ok {
+		p.time = timestampValue(time.Now().UnixNano())
+	}
+	p.note = note
+	st.pins[key] = p
+}
+
+func (st *storage) isPinned(key pinKey) bool {
+	_, ok := st.pins[key]
+	return ok
+}
+
+func hasParent(sp span) int {
+	if sp.parent.notEmpty() {
+		return 1
+	}
+	return 0
+}
+
+// Lists the pins with what they refer to, oldest first. Pins of traces without
+// spans are skipped.
+func (st *storage) pinList(w *arrayifier) {
+	keys := make([]pinKey, 0, len(st.pins))
+	for key := range st.pins {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(k1, k2 pinKey) int {
+		return cmp.Or(cmp.Compare(st.pins[k1].time, st.pins[k2].time), cmp.Compare(k1.kind, k2.kind), cmp.Compare(k1.id, k2.id))
+	})
+	for _, key := range keys {
+		var tr *trace
+		if key.kind == "trace" {
+			tid, _ := parseTraceId(key.id)
+			if tr = st.traces[tid]; tr == nil || len(tr.spans) == 0 {
+				continue
+			}
+		}
+		m := w.submap()
+		m.pair("kind", stringValue(key.kind))
+		m.pair("id", stringValue(key.id))
+		st.pins[key].toJson(&m)
+		var res resId
+		switch key.kind {
+		case "trace":
+			// The root span, or the earliest one if it was not received
+			rootId := slices.MinFunc(slices.Collect(maps.Keys(tr.spans)), func(s1, s2 spanId) int {
+				sp1, sp2 := tr.spans[s1], tr.spans[s2]
+				return cmp.Or(
+					cmp.Compare(hasParent(sp1), hasParent(sp2)),
+					cmp.Compare(sp1.start, sp2.start),
+					cmp.Compare(s1.toString(), s2.toString()),
+				)
+			})
+			root := tr.spans[rootId]
+			m.pair("name", stringValue(root.name))
+			m.pair("span", stringValue(rootId.toString()))
+			m.pair("spans", intValue(len(tr.spans)))
+			res = root.res
+		case "log":
+			id, _ := strconv.Atoi(key.id)
+			i, _ := st.logIndex(id)
+			m.pair("name", stringValue(st.logs[i].simpleBody))
+			m.pair("sev", stringValue(st.logs[i].sev))
+			res = st.logs[i].res
+		case "metric":
+			mid, _ := parseHashId(key.id)
+			metric := st.metrics[hashId(mid)]
+			m.pair("name", stringValue(metric.name))
+			res = metric.res
+		}
+		m.pair("service", stringValue(st.serviceName(res)))
+		m.done()
+	}
+}
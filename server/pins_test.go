@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestPinsSurviveReset(t *testing.T) {
+	st := testStorage(false)
+	receiveTestLogs(t, st, testRequest(), testLogs("checkout", "pinned", "other"))
+	receiveTestLogs(t, st, testRequest(), testLogs("frontend", "forgotten"))
+	kept, forgotten := testTraceId(1, 0), testTraceId(2, 0)
+	receiveTestTraces(t, st, testRequest(), checkoutTrace(kept, time.Now(), ptrace.StatusCodeOk))
+	receiveTestTraces(t, st, testRequest(), checkoutTrace(forgotten, time.Now(), ptrace.StatusCodeOk))
+	pinned := st.logs[0].id
+	st.setPin(logPin(pinned), "flaky")
+	st.setPin(tracePin(traceId(kept)), "")
+
+	st.reset()
+	if len(st.logs) != 1 || st.logs[0].id != pinned {
+		t.Errorf("got %d logs after reset, want only the pinned one", len(st.logs))
+	}
+	if len(st.traces) != 1 || st.traces[traceId(kept)] == nil {
+		t.Errorf("got %d traces after reset, want only the pinned one", len(st.traces))
+	}
+	if p, ok := st.pins[logPin(pinned)]; !ok || p.note != "flaky" {
+		t.Errorf("log pin = %v, want it kept with its note", p)
+	}
+	// The frontend resource is only referred to by the forgotten log
+	if len(st.resources) != 1 || st.serviceName(st.logs[0].res) != "checkout" {
+		t.Errorf("got %d resources after reset, want the checkout one", len(st.resources))
+	}
+
+	// New items get new IDs, so pins cannot end up on other items
+	receiveTestLogs(t, st, testRequest(), testLogs("checkout", "new"))
+	if len(st.logs) != 2 || st.logs[1].id == pinned || st.isPinned(logPin(st.logs[1].id)) {
+		t.Error("a log received after reset took the ID of the pinned log")
+	}
+}
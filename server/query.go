@@ -0,0 +1,142 @@
+package server
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Optional filters on the list endpoints, from the query string:
+// name, service, attr (key=value, repeatable), status, sev, body, trace, since
+type itemFilter struct {
+	name    string
+	service string
+	attr    map[string]string
+	status  string
+	sev     string
+	body    string
+	trace   traceId
+	since   timestampValue
+}
+
+func parseItemFilter(q url.Values) (*itemFilter, error) {
+	if len(q) == 0 {
+		return nil, nil
+	}
+	f := &itemFilter{
+		name:    q.Get("name"),
+		service: q.Get("service"),
+		attr:    map[string]string{},
+		status:  q.Get("status"),
+		sev:     q.Get("sev"),
+		body:    q.Get("body"),
+	}
+	for _, kv := range q["attr"] {
+		k, v, ok := strings.Cut(kv, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid attr filter %q, expected key=value", kv)
+		}
+		f.attr[k] = v
+	}
+	if s := q.Get("trace"); s != "" {
+		tid, ok := parseTraceId(s)
+		if !ok {
+			return nil, fmt.Errorf("invalid trace ID %q", s)
+		}
+		f.trace = tid
+	}
+	if s := q.Get("since"); s != "" {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return nil, fmt.Errorf("invalid since duration %q", s)
+		}
+		f.since = timestampValue(time.Now().Add(-d).UnixNano())
+	}
+	return f, nil
+}
+
+func attrString(v hashableValue) string {
+	if s, ok := v.(stringValue); ok {
+		return string(s)
+	}
+	return fmt.Sprint(toGo(v))
+}
+
+func (f *itemFilter) matchAttr(attr mapValue) bool {
+	for k, want := range f.attr {
+		v, ok := attr.get(k)
+		if !ok || attrString(v) != want {
+			return false
+		}
+	}
+	return true
+}
+
+func (f *itemFilter) matchCommon(st *storage, res resId, name string, t timestampValue) bool {
+	if f.name != "" && !strings.Contains(strings.ToLower(name), strings.ToLower(f.name)) {
+		return false
+	}
+	if f.service != "" {
+		v, ok := st.resources[res].attr.get("service.name")
+		if !ok || attrString(v) != f.service {
+			return false
+		}
+	}
+	return f.since == 0 || t >= f.since
+}
+
+// A nil filter matches everything
+func (f *itemFilter) matchSpan(st *storage, tid traceId, sp span) bool {
+	if f == nil {
+		return true
+	}
+	if f.trace.notEmpty() && tid != f.trace {
+		return false
+	}
+	if f.status != "" && !strings.EqualFold(sp.status, f.status) {
+		return false
+	}
+	if f.sev != "" || f.body != "" {
+		return false
+	}
+	return f.matchCommon(st, sp.res, sp.name, sp.start) && f.matchAttr(sp.attr)
+}
+
+func (f *itemFilter) matchLog(st *storage, l log) bool {
+	if f == nil {
+		return true
+	}
+	if f.trace.notEmpty() && l.trace != f.trace {
+		return false
+	}
+	// "Error" matches Error to Error4, like the UI's severity colors
+	if f.sev != "" && !strings.EqualFold(strings.TrimRight(l.sev, "234"), f.sev) {
+		return false
+	}
+	if f.body != "" && !strings.Contains(strings.ToLower(l.simpleBody), strings.ToLower(f.body)) {
+		return false
+	}
+	if f.status != "" {
+		return false
+	}
+	return f.matchCommon(st, l.res, l.event, l.simpleTime) && f.matchAttr(l.attr)
+}
+
+func (f *itemFilter) matchMetric(st *storage, me *metric) bool {
+	if f == nil {
+		return true
+	}
+	if f.trace.notEmpty() || f.status != "" || f.sev != "" || f.body != "" {
+		return false
+	}
+	var latest timestampValue
+	attrOk := len(f.attr) == 0
+	for _, ms := range me.streams {
+		for _, pt := range ms.points {
+			latest = max(latest, pt.getPoint().time)
+		}
+		attrOk = attrOk || f.matchAttr(ms.attr)
+	}
+	return attrOk && f.matchCommon(st, me.res, me.name, latest)
+}
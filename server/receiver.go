@@ -0,0 +1,403 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Receiver runs the OTLP receivers in-process, so that the telemetry they
+// receive can be inspected; see the telemetrytest package for use in tests.
+type Receiver struct {
+	// Address of the OTLP/gRPC receiver, as host:port
+	GrpcEndpoint string
+	// Base URL of the OTLP/HTTP receiver
+	HttpEndpoint string
+
+	st    *storage
+	stops []stopFunc
+}
+
+// StartReceiver starts the receivers. Call Stop when done.
+//
+// Only the ports, Verbose, Capture, Messages, and the redaction and sampling
+// settings of cfg apply. Unlike with Run, a port of 0 picks an ephemeral one,
+// and the receivers only listen on 127.0.0.1, which works without IPv6.
+func StartReceiver(cfg Config) (*Receiver, error) {
+	redact, err := newRedactor(cfg.RedactRules, cfg.RedactHeaders)
+	if err != nil {
+		return nil, err
+	}
+	r := &Receiver{st: newStorage(cfg.Verbose, cfg.Capture)}
+	if cfg.Messages != nil {
+		r.st.messages = cfg.Messages
+	}
+	r.st.redact = redact
+	sampling := cfg.sampling()
+	if sampling.head < 1 || sampling.rate > 0 || sampling.tail() {
+		r.stops = append(r.stops, startSampling(r.st, sampling))
+	}
+	grpcStop, grpcPort, err := serveOtlpGrpc(r.st, "127.0.0.1", cfg.GrpcPort)
+	if err != nil {
+		r.Stop()
+		return nil, err
+	}
+	r.stops = append(r.stops, grpcStop.stop)
+	httpStop, httpPort, err := serveOtlpHttp(r.st, "127.0.0.1", cfg.HttpPort)
+	if err != nil {
+		r.Stop()
+		return nil, err
+	}
+	r.stops = append(r.stops, httpStop.stop)
+	r.GrpcEndpoint = fmt.Sprintf("127.0.0.1:%d", grpcPort)
+	r.HttpEndpoint = fmt.Sprintf("http://127.0.0.1:%d", httpPort)
+	r.st.setReady(true)
+	return r, nil
+}
+
+// Stop stops the receivers, then the sampling, so that held spans are decided
+func (r *Receiver) Stop() {
+	for _, stop := range slices.Backward(r.stops) {
+		stop.stop()
+	}
+	r.stops = nil
+}
+
+// Reset forgets all telemetry received so far.
+func (r *Receiver) Reset() {
+	r.st.reset()
+}
+
+type Span struct {
+	TraceID       string
+	SpanID        string
+	ParentSpanID  string
+	Name          string
+	Kind          string
+	Status        string // "Ok", "Error", or empty if unset
+	StatusMessage string
+	Start         time.Time
+	End           time.Time
+	Attributes    map[string]any
+	Resource      map[string]any
+	Scope         string
+}
+
+type Log struct {
+	Time         time.Time
+	Severity     string // e.g. "Info" or "Error2", empty if unspecified
+	SeverityText string
+	EventName    string
+	Body         any
+	Attributes   map[string]any
+	Resource     map[string]any
+	Scope        string
+	TraceID      string
+	SpanID       string
+}
+
+type MetricPoint struct {
+	Name       string
+	Type       string // "Gauge", "Sum", "Histogram", "ExponentialHistogram" or "Summary"
+	Unit       string
+	Time       time.Time
+	Attributes map[string]any
+	Resource   map[string]any
+	Scope      string
+	// Set for gauges and sums
+	Value float64
+	// Set for histograms and summaries
+	Count uint64
+	Sum   float64
+}
+
+// Item is a Span, Log or MetricPoint.
+type Item interface {
+	// The name of spans and metric points, and the event name of logs
+	ItemName() string
+	// The attributes of the item, or of its resource
+	ItemAttributes(resource bool) map[string]any
+}
+
+func (s Span) ItemName() string         { return s.Name }
+func (l Log) ItemName() string          { return l.EventName }
+func (mp MetricPoint) ItemName() string { return mp.Name }
+func (s Span) ItemAttributes(resource bool) map[string]any {
+	if resource {
+		return s.Resource
+	}
+	return s.Attributes
+}
+func (l Log) ItemAttributes(resource bool) map[string]any {
+	if resource {
+		return l.Resource
+	}
+	return l.Attributes
+}
+func (mp MetricPoint) ItemAttributes(resource bool) map[string]any {
+	if resource {
+		return mp.Resource
+	}
+	return mp.Attributes
+}
+
+// Matcher filters spans, logs or metric points.
+type Matcher func(Item) bool
+
+// Named matches spans and metric points by name, and logs by event name.
+func Named(name string) Matcher {
+	return func(it Item) bool { return it.ItemName() == name }
+}
+
+// AttrEqual reports whether a received attribute value equals v2, with the
+// conversions described in Attr.
+func AttrEqual(v1 any, v2 any) bool {
+	switch v := v2.(type) {
+	case int:
+		v2 = int64(v)
+	case int32:
+		v2 = int64(v)
+	case float32:
+		v2 = float64(v)
+	}
+	return reflect.DeepEqual(v1, v2)
+}
+
+// Attr matches items with the given attribute. Go ints and floats are compared
+// as int64 and float64.
+func Attr(key string, value any) Matcher {
+	return func(it Item) bool {
+		v, ok := it.ItemAttributes(false)[key]
+		return ok && AttrEqual(v, value)
+	}
+}
+
+// ResourceAttr matches items whose resource has the given attribute.
+func ResourceAttr(key string, value any) Matcher {
+	return func(it Item) bool {
+		v, ok := it.ItemAttributes(true)[key]
+		return ok && AttrEqual(v, value)
+	}
+}
+
+// Severity matches logs by severity range: "Error" matches Error to Error4.
+func Severity(sev string) Matcher {
+	return func(it Item) bool {
+		l, ok := it.(Log)
+		return ok && strings.TrimRight(l.Severity, "234") == sev
+	}
+}
+
+// BodyContains matches logs whose body, formatted as text, contains s.
+func BodyContains(s string) Matcher {
+	return func(it Item) bool {
+		l, ok := it.(Log)
+		return ok && strings.Contains(fmt.Sprint(l.Body), s)
+	}
+}
+
+// Status matches spans by status code ("Ok" or "Error").
+func Status(status string) Matcher {
+	return func(it Item) bool {
+		s, ok := it.(Span)
+		return ok && s.Status == status
+	}
+}
+
+func matchAll(it Item, ms []Matcher) bool {
+	for _, m := range ms {
+		if !m(it) {
+			return false
+		}
+	}
+	return true
+}
+
+func tsTime(t timestampValue) time.Time {
+	if t == 0 {
+		return time.Time{}
+	}
+	return time.Unix(0, int64(t))
+}
+
+// Spans returns the received spans matching all matchers, ordered by start time.
+func (r *Receiver) Spans(ms ...Matcher) []Span {
+	st := r.st
+	st.Lock()
+	defer st.Unlock()
+	var spans []Span
+	for tid, tr := range st.traces {
+		for sid, sp := range tr.spans {
+			s := Span{
+				TraceID:       tid.toString(),
+				SpanID:        sid.toString(),
+				Name:          sp.name,
+				Kind:          sp.kind,
+				Status:        sp.status,
+				StatusMessage: sp.statusMsg,
+				Start:         tsTime(sp.start),
+				End:           tsTime(sp.end),
+				Attributes:    sp.attr.toGo(),
+				Resource:      st.resources[sp.res].attr.toGo(),
+				Scope:         st.scopes[sp.scope].name,
+			}
+			if sp.parent.notEmpty() {
+				s.ParentSpanID = sp.parent.toString()
+			}
+			if matchAll(s, ms) {
+				spans = append(spans, s)
+			}
+		}
+	}
+	slices.SortStableFunc(spans, func(s1 Span, s2 Span) int {
+		return s1.Start.Compare(s2.Start)
+	})
+	return spans
+}
+
+// Logs returns the received logs matching all matchers, in order of reception.
+func (r *Receiver) Logs(ms ...Matcher) []Log {
+	st := r.st
+	st.Lock()
+	defer st.Unlock()
+	var logs []Log
+	for _, lg := range st.logs {
+		l := Log{
+			Time:         tsTime(lg.simpleTime),
+			Severity:     lg.sev,
+			SeverityText: lg.sevText,
+			EventName:    lg.event,
+			Body:         toGo(lg.body),
+			Attributes:   lg.attr.toGo(),
+			Resource:     st.resources[lg.res].attr.toGo(),
+			Scope:        st.scopes[lg.scope].name,
+		}
+		if lg.trace.notEmpty() {
+			l.TraceID = lg.trace.toString()
+		}
+		if lg.span.notEmpty() {
+			l.SpanID = lg.span.toString()
+		}
+		if matchAll(l, ms) {
+			logs = append(logs, l)
+		}
+	}
+	return logs
+}
+
+// CountLogs returns the number of received logs matching all matchers.
+func (r *Receiver) CountLogs(ms ...Matcher) int {
+	return len(r.Logs(ms...))
+}
+
+// MetricPoints returns the received points of the named metric matching all
+// matchers, ordered by time.
+func (r *Receiver) MetricPoints(name string, ms ...Matcher) []MetricPoint {
+	st := r.st
+	st.Lock()
+	defer st.Unlock()
+	var points []MetricPoint
+	for _, m := range st.metrics {
+		if m.name != name {
+			continue
+		}
+		for _, stream := range m.streams {
+			for _, pt := range stream.points {
+				mp := MetricPoint{
+					Name:       m.name,
+					Type:       m.type_,
+					Unit:       m.unit,
+					Time:       tsTime(pt.getPoint().time),
+					Attributes: stream.attr.toGo(),
+					Resource:   st.resources[m.res].attr.toGo(),
+					Scope:      st.scopes[m.scope].name,
+				}
+				switch pt := pt.(type) {
+				case numberPoint:
+					switch v := pt.value.(type) {
+					case intValue:
+						mp.Value = float64(v)
+					case doubleValue:
+						mp.Value = float64(v)
+					}
+				case histogramPoint:
+					mp.Count, mp.Sum = pt.count, pt.sum
+				case exponentialHistogramPoint:
+					mp.Count, mp.Sum = pt.count, pt.sum
+				case summaryPoint:
+					mp.Count, mp.Sum = pt.count, pt.sum
+				}
+				if matchAll(mp, ms) {
+					points = append(points, mp)
+				}
+			}
+		}
+	}
+	slices.SortStableFunc(points, func(p1 MetricPoint, p2 MetricPoint) int {
+		return p1.Time.Compare(p2.Time)
+	})
+	return points
+}
+
+// LastValue returns the value of the most recent point of a gauge or sum.
+func (r *Receiver) LastValue(name string, ms ...Matcher) (float64, bool) {
+	points := r.MetricPoints(name, ms...)
+	if len(points) == 0 {
+		return 0, false
+	}
+	return points[len(points)-1].Value, true
+}
+
+const harnessPoll = 10 * time.Millisecond
+
+func waitFor[T any](ctx context.Context, what string, get func() ([]T, bool)) ([]T, error) {
+	ticker := time.NewTicker(harnessPoll)
+	defer ticker.Stop()
+	for {
+		items, ok := get()
+		if ok {
+			return items, nil
+		}
+		select {
+		case <-ctx.Done():
+			return items, fmt.Errorf("timed out waiting for %s: found %d", what, len(items))
+		case <-ticker.C:
+		}
+	}
+}
+
+// WaitForSpan waits until a span matching all matchers is received.
+func (r *Receiver) WaitForSpan(ctx context.Context, ms ...Matcher) (Span, error) {
+	spans, err := waitFor(ctx, "span", func() ([]Span, bool) {
+		spans := r.Spans(ms...)
+		return spans, len(spans) > 0
+	})
+	if err != nil {
+		return Span{}, err
+	}
+	return spans[0], nil
+}
+
+// WaitForLogs waits until at least n logs matching all matchers are received.
+func (r *Receiver) WaitForLogs(ctx context.Context, n int, ms ...Matcher) ([]Log, error) {
+	return waitFor(ctx, fmt.Sprintf("%d logs", n), func() ([]Log, bool) {
+		logs := r.Logs(ms...)
+		return logs, len(logs) >= n
+	})
+}
+
+// WaitForMetric waits until a point of the named metric matching all matchers
+// is received, and returns the most recent one.
+func (r *Receiver) WaitForMetric(ctx context.Context, name string, ms ...Matcher) (MetricPoint, error) {
+	points, err := waitFor(ctx, "metric "+name, func() ([]MetricPoint, bool) {
+		points := r.MetricPoints(name, ms...)
+		return points, len(points) > 0
+	})
+	if err != nil {
+		return MetricPoint{}, err
+	}
+	return points[len(points)-1], nil
+}
@@ -0,0 +1,389 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"regexp"
+	"slices"
+	"strings"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+// RedactRule transforms the attributes whose key and/or string value match.
+// Key patterns must match the whole key, value patterns any part of the value.
+type RedactRule struct {
+	Key    string `yaml:"key"`
+	Value  string `yaml:"value"`
+	Action string `yaml:"action"` // drop, hash, mask or rename
+	To     string `yaml:"to"`     // new key, for rename
+}
+
+const redactedMask = "***"
+
+type redactRule struct {
+	key    *regexp.Regexp
+	value  *regexp.Regexp
+	action string
+	to     string
+}
+
+// Returns the field at fault with the error
+func (r RedactRule) compile() (redactRule, string, error) {
+	rule := redactRule{action: r.Action, to: r.To}
+	var err error
+	if r.Key != "" {
+		if _, err = regexp.Compile(r.Key); err != nil {
+			return rule, "key", err
+		}
+		rule.key = regexp.MustCompile("^(?:" + r.Key + ")$")
+	}
+	if r.Value != "" {
+		if rule.value, err = regexp.Compile(r.Value); err != nil {
+			return rule, "value", err
+		}
+	}
+	if rule.key == nil && rule.value == nil {
+		return rule, "key", errors.New("key or value must be set")
+	}
+	switch r.Action {
+	case "drop", "hash", "mask":
+	case "rename":
+		if r.To == "" {
+			return rule, "to", errors.New("must be set for rename")
+		}
+		if rule.key == nil {
+			return rule, "key", errors.New("must be set for rename")
+		}
+	default:
+		return rule, "action", fmt.Errorf("must be drop, hash, mask or rename, got %q", r.Action)
+	}
+	return rule, "", nil
+}
+
+func (r redactRule) matches(p pair) bool {
+	if r.key != nil && !r.key.MatchString(p.K) {
+		return false
+	}
+	if r.value != nil {
+		s, ok := p.V.(stringValue)
+		return ok && r.value.MatchString(string(s))
+	}
+	return true
+}
+
+// Applied to attributes, log bodies and request headers before they are
+// stored, so that secrets never show up in the UI, the API or the NDJSON
+// output, and to requests before they are forwarded
+type redactor struct {
+	rules   []redactRule
+	headers []string
+}
+
+func newRedactor(rules []RedactRule, headers []string) (*redactor, error) {
+	if len(rules) == 0 && len(headers) == 0 {
+		return nil, nil
+	}
+	rd := &redactor{headers: headers}
+	for i, r := range rules {
+		rule, field, err := r.compile()
+		if err != nil {
+			return nil, fmt.Errorf("redact rule %d, %s: %w", i, field, err)
+		}
+		rd.rules = append(rd.rules, rule)
+	}
+	return rd, nil
+}
+
+func redactHash(v hashableValue) stringValue {
+	s, ok := v.(stringValue)
+	if !ok {
+		s = stringValue(jsonToString(v))
+	}
+	sum := sha256.Sum256([]byte(s))
+	return stringValue("sha256:" + hex.EncodeToString(sum[:8]))
+}
+
+// Applies the rules to an attribute, then to the maps and arrays nested in its
+// value. Without a key (for log bodies and array elements), only the rules
+// matching values alone apply. Returns false if the attribute is dropped.
+func (rd *redactor) apply(p pair, keyed bool) (_ pair, renamed bool, ok bool) {
+	for _, r := range rd.rules {
+		if (!keyed && r.key != nil) || !r.matches(p) {
+			continue
+		}
+		switch r.action {
+		case "drop":
+			return p, false, false
+		case "hash":
+			p.V = redactHash(p.V)
+		case "mask":
+			if s, ok := p.V.(stringValue); ok && r.value != nil {
+				p.V = stringValue(r.value.ReplaceAllString(string(s), redactedMask))
+			} else {
+				p.V = stringValue(redactedMask)
+			}
+		case "rename":
+			p.K = r.to
+			renamed = true
+		}
+	}
+	switch v := p.V.(type) {
+	case mapValue:
+		p.V = rd.attrs(v)
+	case arrayValue:
+		var a arrayValue
+		for _, x := range v.Items {
+			if x := rd.value(x); x != nil {
+				a.add(x)
+			}
+		}
+		p.V = a
+	}
+	return p, renamed, true
+}
+
+// Redacts a value without a key, such as a log body; returns nil if it is
+// dropped
+func (rd *redactor) value(v hashableValue) hashableValue {
+	if rd == nil || len(rd.rules) == 0 {
+		return v
+	}
+	p, _, ok := rd.apply(pair{V: v}, false)
+	if !ok {
+		return nil
+	}
+	return p.V
+}
+
+func (rd *redactor) attrs(m mapValue) mapValue {
+	if rd == nil || len(rd.rules) == 0 || !m.notEmpty() {
+		return m
+	}
+	var kept, renamed []pair
+	for _, p := range m.Pairs {
+		p, wasRenamed, ok := rd.apply(p, true)
+		if !ok {
+			continue
+		}
+		if wasRenamed {
+			renamed = append(renamed, p)
+		} else {
+			kept = append(kept, p)
+		}
+	}
+	// A renamed attribute replaces any existing one with the same key
+	for _, p := range renamed {
+		kept = slices.DeleteFunc(kept, func(p2 pair) bool { return p2.K == p.K })
+		kept = append(kept, p)
+	}
+	slices.SortStableFunc(kept, func(p1 pair, p2 pair) int {
+		return strings.Compare(p1.K, p2.K)
+	})
+	return mapValue{Pairs: kept}
+}
+
+func (rd *redactor) request(req requestMeta) requestMeta {
+	if rd == nil || len(rd.headers) == 0 {
+		return req
+	}
+	headers := maps.Clone(req.headers)
+	for name, vals := range headers {
+		for _, h := range rd.headers {
+			if strings.EqualFold(name, h) {
+				headers[name] = slices.Repeat([]string{redactedMask}, len(vals))
+			}
+		}
+	}
+	req.headers = headers
+	return req
+}
+
+// Decodes a kept request body, redacts it, and encodes it again in the same
+// format. Bodies which cannot be decoded, such as the truncated bodies of
+// rejected requests, are not kept.
+func (rd *redactor) payload(signal string, pl payload) payload {
+	if rd == nil || len(rd.rules) == 0 || pl.body == nil {
+		return pl
+	}
+	req := newExportRequest(signal)
+	asJson := pl.contentType == "application/json"
+	var err error
+	if asJson {
+		err = req.UnmarshalJSON(pl.body)
+	} else {
+		err = req.UnmarshalProto(pl.body)
+	}
+	if err != nil {
+		pl.body = nil
+		return pl
+	}
+	rd.export(req)
+	if asJson {
+		pl.body, err = req.MarshalJSON()
+	} else {
+		pl.body, err = req.MarshalProto()
+	}
+	if err != nil {
+		pl.body = nil
+	}
+	return pl
+}
+
+func (rd *redactor) pdataAttrs(m pcommon.Map) {
+	attrs := rd.attrs(convertMap(m))
+	m.Clear()
+	attrs.copyTo(m)
+}
+
+func (rd *redactor) exemplars(es pmetric.ExemplarSlice) {
+	for i := range es.Len() {
+		rd.pdataAttrs(es.At(i).FilteredAttributes())
+	}
+}
+
+// Redacts the attribute table of a profile, and removes dropped attributes
+// from the indices referring to it
+func (rd *redactor) profileAttrs(p pprofile.Profile) {
+	table := p.AttributeTable()
+	dropped := map[int32]bool{}
+	for i := range table.Len() {
+		a := table.At(i)
+		p, _, ok := rd.apply(pair{a.Key(), convertValue(a.Value())}, true)
+		if !ok {
+			dropped[int32(i)] = true
+			p = pair{"", stringValue("")}
+		}
+		a.SetKey(p.K)
+		putValue(a.Value(), p.V)
+	}
+	if len(dropped) == 0 {
+		return
+	}
+	filter := func(indices pcommon.Int32Slice) {
+		indices.FromRaw(slices.DeleteFunc(indices.AsRaw(), func(i int32) bool { return dropped[i] }))
+	}
+	filter(p.AttributeIndices())
+	for i := range p.Sample().Len() {
+		filter(p.Sample().At(i).AttributeIndices())
+	}
+	for i := range p.LocationTable().Len() {
+		filter(p.LocationTable().At(i).AttributeIndices())
+	}
+	for i := range p.MappingTable().Len() {
+		filter(p.MappingTable().At(i).AttributeIndices())
+	}
+}
+
+// Redacts an OTLP request in place, as its contents are when stored
+func (rd *redactor) export(req exportRequest) {
+	if rd == nil || len(rd.rules) == 0 {
+		return
+	}
+	switch req := req.(type) {
+	case *ptraceotlp.ExportRequest:
+		rss := req.Traces().ResourceSpans()
+		for i := range rss.Len() {
+			rd.pdataAttrs(rss.At(i).Resource().Attributes())
+			sss := rss.At(i).ScopeSpans()
+			for j := range sss.Len() {
+				rd.pdataAttrs(sss.At(j).Scope().Attributes())
+				spans := sss.At(j).Spans()
+				for k := range spans.Len() {
+					sp := spans.At(k)
+					rd.pdataAttrs(sp.Attributes())
+					for l := range sp.Events().Len() {
+						rd.pdataAttrs(sp.Events().At(l).Attributes())
+					}
+					for l := range sp.Links().Len() {
+						rd.pdataAttrs(sp.Links().At(l).Attributes())
+					}
+				}
+			}
+		}
+	case *plogotlp.ExportRequest:
+		rls := req.Logs().ResourceLogs()
+		for i := range rls.Len() {
+			rd.pdataAttrs(rls.At(i).Resource().Attributes())
+			sls := rls.At(i).ScopeLogs()
+			for j := range sls.Len() {
+				rd.pdataAttrs(sls.At(j).Scope().Attributes())
+				lrs := sls.At(j).LogRecords()
+				for k := range lrs.Len() {
+					lr := lrs.At(k)
+					rd.pdataAttrs(lr.Attributes())
+					if lr.Body().Type() != pcommon.ValueTypeEmpty {
+						if body := rd.value(convertValue(lr.Body())); body != nil {
+							putValue(lr.Body(), body)
+						} else {
+							pcommon.NewValueEmpty().CopyTo(lr.Body())
+						}
+					}
+				}
+			}
+		}
+	case *pmetricotlp.ExportRequest:
+		rms := req.Metrics().ResourceMetrics()
+		for i := range rms.Len() {
+			rd.pdataAttrs(rms.At(i).Resource().Attributes())
+			sms := rms.At(i).ScopeMetrics()
+			for j := range sms.Len() {
+				rd.pdataAttrs(sms.At(j).Scope().Attributes())
+				ms := sms.At(j).Metrics()
+				for k := range ms.Len() {
+					m := ms.At(k)
+					rd.pdataAttrs(m.Metadata())
+					var numbers pmetric.NumberDataPointSlice
+					switch m.Type() {
+					case pmetric.MetricTypeGauge:
+						numbers = m.Gauge().DataPoints()
+					case pmetric.MetricTypeSum:
+						numbers = m.Sum().DataPoints()
+					case pmetric.MetricTypeHistogram:
+						for l := range m.Histogram().DataPoints().Len() {
+							dp := m.Histogram().DataPoints().At(l)
+							rd.pdataAttrs(dp.Attributes())
+							rd.exemplars(dp.Exemplars())
+						}
+					case pmetric.MetricTypeExponentialHistogram:
+						for l := range m.ExponentialHistogram().DataPoints().Len() {
+							dp := m.ExponentialHistogram().DataPoints().At(l)
+							rd.pdataAttrs(dp.Attributes())
+							rd.exemplars(dp.Exemplars())
+						}
+					case pmetric.MetricTypeSummary:
+						for l := range m.Summary().DataPoints().Len() {
+							rd.pdataAttrs(m.Summary().DataPoints().At(l).Attributes())
+						}
+					}
+					for l := range numbers.Len() {
+						rd.pdataAttrs(numbers.At(l).Attributes())
+						rd.exemplars(numbers.At(l).Exemplars())
+					}
+				}
+			}
+		}
+	case *pprofileotlp.ExportRequest:
+		rps := req.Profiles().ResourceProfiles()
+		for i := range rps.Len() {
+			rd.pdataAttrs(rps.At(i).Resource().Attributes())
+			sps := rps.At(i).ScopeProfiles()
+			for j := range sps.Len() {
+				rd.pdataAttrs(sps.At(j).Scope().Attributes())
+				ps := sps.At(j).Profiles()
+				for k := range ps.Len() {
+					rd.profileAttrs(ps.At(k))
+				}
+			}
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+)
+
+func redactingStorage(t *testing.T, capture bool, rules ...RedactRule) *storage {
+	t.Helper()
+	st := testStorage(capture)
+	rd, err := newRedactor(rules, []string{"Authorization"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	st.redact = rd
+	return st
+}
+
+func TestRedaction(t *testing.T) {
+	st := redactingStorage(t, false,
+		RedactRule{Key: `password|token`, Action: "drop"},
+		RedactRule{Key: `user\.id`, Action: "hash"},
+		RedactRule{Value: `[\w.+-]+@[\w-]+\.[\w.]+`, Action: "mask"},
+		RedactRule{Key: `db\.statement`, Action: "rename", To: "db.query.text"},
+	)
+
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", "users")
+	rl.Resource().Attributes().PutStr("token", "abc")
+	lr := rl.ScopeLogs().AppendEmpty().LogRecords().AppendEmpty()
+	lr.SetEventName("login")
+	lr.Attributes().PutStr("password", "hunter2")
+	lr.Attributes().PutStr("user.id", "42")
+	lr.Attributes().PutStr("user.contact", "mail bob@example.com now")
+	lr.Attributes().PutStr("db.statement", "SELECT 1")
+	receiveTestLogs(t, st, testRequest(), ld)
+
+	l := (&Receiver{st: st}).Logs(Named("login"))[0]
+	if _, ok := l.Resource["token"]; ok {
+		t.Error("resource attribute token was not dropped")
+	}
+	if _, ok := l.Attributes["password"]; ok {
+		t.Error("attribute password was not dropped")
+	}
+	if id, _ := l.Attributes["user.id"].(string); !strings.HasPrefix(id, "sha256:") {
+		t.Errorf("user.id = %q, want a hash", id)
+	}
+	if got := l.Attributes["user.contact"]; got != "mail *** now" {
+		t.Errorf("user.contact = %q, want the email masked", got)
+	}
+	if got := l.Attributes["db.query.text"]; got != "SELECT 1" {
+		t.Errorf("db.query.text = %q, want the renamed db.statement", got)
+	}
+	if _, ok := l.Attributes["db.statement"]; ok {
+		t.Error("db.statement was not renamed")
+	}
+}
+
+func TestNestedRedaction(t *testing.T) {
+	st := redactingStorage(t, false,
+		RedactRule{Key: `password`, Action: "drop"},
+		RedactRule{Value: `[\w.+-]+@[\w-]+\.[\w.]+`, Action: "mask"},
+	)
+
+	ld := plog.NewLogs()
+	lrs := ld.ResourceLogs().AppendEmpty().ScopeLogs().AppendEmpty().LogRecords()
+	lr := lrs.AppendEmpty()
+	lr.SetEventName("signup")
+	form := lr.Attributes().PutEmptyMap("form")
+	form.PutStr("password", "hunter2")
+	form.PutStr("contact", "bob@example.com")
+	lr.Attributes().PutEmptySlice("cc").AppendEmpty().SetStr("alice@example.com")
+	body := lr.Body().SetEmptyMap()
+	body.PutStr("password", "hunter2")
+	body.PutEmptySlice("to").AppendEmpty().SetStr("carol@example.com")
+	lrs.AppendEmpty().Body().SetStr("mail sent to dave@example.com")
+	receiveTestLogs(t, st, testRequest(), ld)
+
+	logs := (&Receiver{st: st}).Logs()
+	if len(logs) != 2 {
+		t.Fatalf("got %d logs, want 2", len(logs))
+	}
+	got := fmt.Sprint(logs[0].Attributes, logs[0].Body, logs[1].Body)
+	for _, secret := range []string{"hunter2", "@example.com"} {
+		if strings.Contains(got, secret) {
+			t.Errorf("%q was not redacted: %s", secret, got)
+		}
+	}
+	if form, _ := logs[0].Attributes["form"].(map[string]any); form["contact"] != "***" {
+		t.Errorf("form = %v, want contact masked", form)
+	}
+	if logs[1].Body != "mail sent to ***" {
+		t.Errorf("body = %q, want the email masked", logs[1].Body)
+	}
+}
+
+// Captured bodies are kept, but redacted like the stored telemetry
+func TestCaptureRedaction(t *testing.T) {
+	st := redactingStorage(t, true,
+		RedactRule{Key: `password`, Action: "drop"},
+		RedactRule{Value: `[\w.+-]+@[\w-]+\.[\w.]+`, Action: "mask"},
+	)
+	ld := testLogs("users", "welcome bob@example.com")
+	ld.ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0).Attributes().PutStr("password", "hunter2")
+	receiveTestLogs(t, st, testRequest("Authorization", "Bearer secret"), ld)
+
+	if len(st.calls) != 1 || st.calls[0].body == nil {
+		t.Fatal("the request body was not captured")
+	}
+	req := plogotlp.NewExportRequest()
+	if err := req.UnmarshalProto(st.calls[0].body); err != nil {
+		t.Fatalf("the captured body does not decode: %v", err)
+	}
+	lr := req.Logs().ResourceLogs().At(0).ScopeLogs().At(0).LogRecords().At(0)
+	if body := lr.Body().Str(); body != "welcome ***" {
+		t.Errorf("captured body = %q, want the email masked", body)
+	}
+	if _, ok := lr.Attributes().Get("password"); ok {
+		t.Error("password was not dropped from the captured body")
+	}
+	if got := st.requests[st.calls[0].req].header("Authorization"); got != "***" {
+		t.Errorf("Authorization = %q, want it hidden", got)
+	}
+}
@@ -0,0 +1,555 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+const replayBatchSize = 1000 // spans, logs or points per request
+
+type replayRequest struct {
+	Target      string            `json:"target"`
+	Headers     map[string]string `json:"headers"`
+	Compression string            `json:"compression"`
+	Now         bool              `json:"now"`
+	NewTraceIds bool              `json:"newTraceIds"`
+	All         bool              `json:"all"`
+	Traces      []string          `json:"traces"`
+	Logs        []int             `json:"logs"`
+	Metrics     []string          `json:"metrics"` // metric ID, or metric ID and stream ID separated by "/"
+}
+
+type replayStream struct {
+	metric  hashId
+	streams []hashId // nil means all streams
+}
+
+type replaySelection struct {
+	traces  []traceId
+	logs    []int
+	metrics []replayStream
+}
+
+type replayResult struct {
+	requests int
+	spans    int
+	logs     int
+	points   int
+}
+
+func (rr replayResult) toJson(m *mapifier) {
+	m.pair("requests", intValue(rr.requests))
+	m.pair("spans", intValue(rr.spans))
+	m.pair("logs", intValue(rr.logs))
+	m.pair("points", intValue(rr.points))
+}
+
+// Requires the lock to be held
+func (st *storage) replaySelection(rr replayRequest) (replaySelection, error) {
+	var sel replaySelection
+	if rr.All {
+		for tid := range st.traces {
+			sel.traces = append(sel.traces, tid)
+		}
+		for i := range st.logs {
+			sel.logs = append(sel.logs, i)
+		}
+		for mid := range st.metrics {
+			sel.metrics = append(sel.metrics, replayStream{metric: mid})
+		}
+		return sel, nil
+	}
+	for _, s := range rr.Traces {
+		tid, ok := parseTraceId(s)
+		if !ok {
+			return sel, fmt.Errorf("invalid trace ID %q", s)
+		}
+		if _, ok := st.traces[tid]; !ok {
+			return sel, fmt.Errorf("unknown trace %s", s)
+		}
+		sel.traces = append(sel.traces, tid)
+	}
+	for _, id := range rr.Logs {
+		i, ok := st.logIndex(id)
+		if !ok {
+			return sel, fmt.Errorf("unknown log %d", id)
+		}
+		sel.logs = append(sel.logs, i)
+	}
+	for _, s := range rr.Metrics {
+		metricStr, streamStr, hasStream := strings.Cut(s, "/")
+		mid, ok := parseHashId(metricStr)
+		if !ok {
+			return sel, fmt.Errorf("invalid metric ID %q", metricStr)
+		}
+		metric, ok := st.metrics[hashId(mid)]
+		if !ok {
+			return sel, fmt.Errorf("unknown metric %s", metricStr)
+		}
+		rs := replayStream{metric: hashId(mid)}
+		if hasStream {
+			sid, ok := parseHashId(streamStr)
+			if !ok {
+				return sel, fmt.Errorf("invalid metric stream ID %q", streamStr)
+			}
+			if _, ok := metric.streams[hashId(sid)]; !ok {
+				return sel, fmt.Errorf("unknown stream %s of metric %s", streamStr, metricStr)
+			}
+			rs.streams = []hashId{hashId(sid)}
+		}
+		sel.metrics = append(sel.metrics, rs)
+	}
+	return sel, nil
+}
+
+func (sel replaySelection) streams(st *storage, rs replayStream) []*metricStream {
+	metric := st.metrics[rs.metric]
+	if rs.streams == nil {
+		var streams []*metricStream
+		for _, ms := range metric.streams {
+			streams = append(streams, ms)
+		}
+		return streams
+	}
+	var streams []*metricStream
+	for _, sid := range rs.streams {
+		streams = append(streams, metric.streams[sid])
+	}
+	return streams
+}
+
+func (sel replaySelection) latest(st *storage) timestampValue {
+	var latest timestampValue
+	for _, tid := range sel.traces {
+		for _, span := range st.traces[tid].spans {
+			latest = max(latest, span.end)
+		}
+	}
+	for _, i := range sel.logs {
+		latest = max(latest, st.logs[i].simpleTime)
+	}
+	for _, rs := range sel.metrics {
+		for _, ms := range sel.streams(st, rs) {
+			for _, pt := range ms.points {
+				latest = max(latest, pt.getPoint().time)
+			}
+		}
+	}
+	return latest
+}
+
+// Converts stored items back into OTLP, optionally shifting timestamps and renaming traces
+type replayer struct {
+	st       *storage
+	shift    int64
+	renameTo map[traceId]traceId
+}
+
+func (rp *replayer) ts(t timestampValue) pcommon.Timestamp {
+	if t == 0 {
+		return 0
+	}
+	return pcommon.Timestamp(int64(t) + rp.shift)
+}
+
+func (rp *replayer) traceId(tid traceId) pcommon.TraceID {
+	if rp.renameTo == nil || !tid.notEmpty() {
+		return pcommon.TraceID(tid)
+	}
+	tid2, ok := rp.renameTo[tid]
+	if !ok {
+		randomBytes(tid2[:])
+		rp.renameTo[tid] = tid2
+	}
+	return pcommon.TraceID(tid2)
+}
+
+func (rp *replayer) setResource(dst pcommon.Resource, rid resId) string {
+	res := rp.st.resources[rid]
+	res.attr.copyTo(dst.Attributes())
+	dst.SetDroppedAttributesCount(res.attrDropped)
+	return res.schema
+}
+
+func (rp *replayer) setScope(dst pcommon.InstrumentationScope, sid scopeId) string {
+	sc := rp.st.scopes[sid]
+	dst.SetName(sc.name)
+	dst.SetVersion(sc.version)
+	sc.attr.copyTo(dst.Attributes())
+	dst.SetDroppedAttributesCount(sc.attrDropped)
+	return sc.schema
+}
+
+type resScope struct {
+	res   resId
+	scope scopeId
+}
+
+var spanKinds = map[string]ptrace.SpanKind{}
+var statusCodes = map[string]ptrace.StatusCode{}
+var severities = map[string]plog.SeverityNumber{}
+var temporalities = map[string]pmetric.AggregationTemporality{}
+
+func init() {
+	for k := ptrace.SpanKindUnspecified; k <= ptrace.SpanKindConsumer; k++ {
+		spanKinds[k.String()] = k
+	}
+	for c := ptrace.StatusCodeUnset; c <= ptrace.StatusCodeError; c++ {
+		statusCodes[c.String()] = c
+	}
+	for s := plog.SeverityNumberUnspecified; s <= plog.SeverityNumberFatal4; s++ {
+		severities[s.String()] = s
+	}
+	for t := pmetric.AggregationTemporalityUnspecified; t <= pmetric.AggregationTemporalityCumulative; t++ {
+		temporalities[t.String()] = t
+	}
+}
+
+func (rp *replayer) traces(tids []traceId) []exportRequest {
+	var reqs []exportRequest
+	td := ptrace.NewTraces()
+	rss := map[resId]ptrace.ResourceSpans{}
+	scss := map[resScope]ptrace.ScopeSpans{}
+	for _, tid := range tids {
+		for sid, span := range rp.st.traces[tid].spans {
+			rs, ok := rss[span.res]
+			if !ok {
+				rs = td.ResourceSpans().AppendEmpty()
+				rs.SetSchemaUrl(rp.setResource(rs.Resource(), span.res))
+				rss[span.res] = rs
+			}
+			scs, ok := scss[resScope{span.res, span.scope}]
+			if !ok {
+				scs = rs.ScopeSpans().AppendEmpty()
+				scs.SetSchemaUrl(rp.setScope(scs.Scope(), span.scope))
+				scss[resScope{span.res, span.scope}] = scs
+			}
+
+			sp := scs.Spans().AppendEmpty()
+			sp.SetTraceID(rp.traceId(tid))
+			sp.SetSpanID(pcommon.SpanID(sid))
+			sp.SetParentSpanID(pcommon.SpanID(span.parent))
+			sp.SetName(span.name)
+			sp.SetKind(spanKinds[span.kind])
+			sp.SetStartTimestamp(rp.ts(span.start))
+			sp.SetEndTimestamp(rp.ts(span.end))
+			sp.Status().SetCode(statusCodes[span.status])
+			sp.Status().SetMessage(span.statusMsg)
+			span.attr.copyTo(sp.Attributes())
+			sp.SetDroppedAttributesCount(span.attrDropped)
+			sp.TraceState().FromRaw(span.state)
+			sp.SetFlags(uint32(span.flags))
+			for _, e := range span.events {
+				e2 := sp.Events().AppendEmpty()
+				e2.SetName(e.name)
+				e2.SetTimestamp(rp.ts(e.time))
+				e.attr.copyTo(e2.Attributes())
+				e2.SetDroppedAttributesCount(e.attrDropped)
+			}
+			sp.SetDroppedEventsCount(span.eventsDropped)
+			for _, l := range span.links {
+				l2 := sp.Links().AppendEmpty()
+				l2.SetTraceID(rp.traceId(l.trace))
+				l2.SetSpanID(pcommon.SpanID(l.span))
+				l.attr.copyTo(l2.Attributes())
+				l2.SetDroppedAttributesCount(l.attrDropped)
+				l2.TraceState().FromRaw(l.state)
+			}
+			sp.SetDroppedLinksCount(span.linksDropped)
+		}
+		if td.SpanCount() >= replayBatchSize {
+			req := ptraceotlp.NewExportRequestFromTraces(td)
+			reqs = append(reqs, &req)
+			td = ptrace.NewTraces()
+			clear(rss)
+			clear(scss)
+		}
+	}
+	if td.SpanCount() > 0 {
+		req := ptraceotlp.NewExportRequestFromTraces(td)
+		reqs = append(reqs, &req)
+	}
+	return reqs
+}
+
+func (rp *replayer) logs(indices []int) []exportRequest {
+	var reqs []exportRequest
+	ld := plog.NewLogs()
+	rls := map[resId]plog.ResourceLogs{}
+	scls := map[resScope]plog.ScopeLogs{}
+	for _, i := range indices {
+		log := rp.st.logs[i]
+		rl, ok := rls[log.res]
+		if !ok {
+			rl = ld.ResourceLogs().AppendEmpty()
+			rl.SetSchemaUrl(rp.setResource(rl.Resource(), log.res))
+			rls[log.res] = rl
+		}
+		scl, ok := scls[resScope{log.res, log.scope}]
+		if !ok {
+			scl = rl.ScopeLogs().AppendEmpty()
+			scl.SetSchemaUrl(rp.setScope(scl.Scope(), log.scope))
+			scls[resScope{log.res, log.scope}] = scl
+		}
+
+		lr := scl.LogRecords().AppendEmpty()
+		lr.SetTimestamp(rp.ts(log.time))
+		lr.SetObservedTimestamp(rp.ts(log.timeObs))
+		lr.SetSeverityNumber(severities[log.sev])
+		lr.SetSeverityText(log.sevText)
+		lr.SetEventName(log.event)
+		if log.body != nil {
+			putValue(lr.Body(), log.body.(hashableValue))
+		}
+		log.attr.copyTo(lr.Attributes())
+		lr.SetDroppedAttributesCount(log.attrDropped)
+		lr.SetFlags(plog.LogRecordFlags(log.flags))
+		lr.SetTraceID(rp.traceId(log.trace))
+		lr.SetSpanID(pcommon.SpanID(log.span))
+
+		if ld.LogRecordCount() >= replayBatchSize {
+			req := plogotlp.NewExportRequestFromLogs(ld)
+			reqs = append(reqs, &req)
+			ld = plog.NewLogs()
+			clear(rls)
+			clear(scls)
+		}
+	}
+	if ld.LogRecordCount() > 0 {
+		req := plogotlp.NewExportRequestFromLogs(ld)
+		reqs = append(reqs, &req)
+	}
+	return reqs
+}
+
+func (rp *replayer) setPoint(p point, attr mapValue, dst interface {
+	Attributes() pcommon.Map
+	SetTimestamp(pcommon.Timestamp)
+	SetStartTimestamp(pcommon.Timestamp)
+	SetFlags(pmetric.DataPointFlags)
+}) {
+	attr.copyTo(dst.Attributes())
+	dst.SetTimestamp(rp.ts(p.time))
+	dst.SetStartTimestamp(rp.ts(p.timeStart))
+	dst.SetFlags(pmetric.DataPointFlags(p.flags))
+}
+
+func (rp *replayer) setExemplars(dst pmetric.ExemplarSlice, exemplars []exemplar) {
+	for _, e := range exemplars {
+		e2 := dst.AppendEmpty()
+		e2.SetTimestamp(rp.ts(e.time))
+		switch v := e.value.(type) {
+		case intValue:
+			e2.SetIntValue(int64(v))
+		case doubleValue:
+			e2.SetDoubleValue(float64(v))
+		}
+		e.attr.copyTo(e2.FilteredAttributes())
+		e2.SetTraceID(rp.traceId(e.trace))
+		e2.SetSpanID(pcommon.SpanID(e.span))
+	}
+}
+
+func (rp *replayer) setHistolike(hlp histolikePoint, dst interface {
+	SetCount(uint64)
+	SetSum(float64)
+	SetMin(float64)
+	SetMax(float64)
+	Exemplars() pmetric.ExemplarSlice
+}) {
+	dst.SetCount(hlp.count)
+	if hlp.has.sum {
+		dst.SetSum(hlp.sum)
+	}
+	if hlp.has.min {
+		dst.SetMin(hlp.min)
+	}
+	if hlp.has.max {
+		dst.SetMax(hlp.max)
+	}
+	rp.setExemplars(dst.Exemplars(), hlp.exemplars)
+}
+
+func (rp *replayer) setNumberPoint(dst pmetric.NumberDataPointSlice, attr mapValue, pt pointlike) {
+	np := pt.(numberPoint)
+	dp := dst.AppendEmpty()
+	rp.setPoint(np.point, attr, dp)
+	switch v := np.value.(type) {
+	case intValue:
+		dp.SetIntValue(int64(v))
+	case doubleValue:
+		dp.SetDoubleValue(float64(v))
+	}
+	rp.setExemplars(dp.Exemplars(), np.exemplars)
+}
+
+func (rp *replayer) metrics(sel replaySelection) []exportRequest {
+	var reqs []exportRequest
+	md := pmetric.NewMetrics()
+	rms := map[resId]pmetric.ResourceMetrics{}
+	scms := map[resScope]pmetric.ScopeMetrics{}
+	for _, rs := range sel.metrics {
+		metric := rp.st.metrics[rs.metric]
+		rm, ok := rms[metric.res]
+		if !ok {
+			rm = md.ResourceMetrics().AppendEmpty()
+			rm.SetSchemaUrl(rp.setResource(rm.Resource(), metric.res))
+			rms[metric.res] = rm
+		}
+		scm, ok := scms[resScope{metric.res, metric.scope}]
+		if !ok {
+			scm = rm.ScopeMetrics().AppendEmpty()
+			scm.SetSchemaUrl(rp.setScope(scm.Scope(), metric.scope))
+			scms[resScope{metric.res, metric.scope}] = scm
+		}
+
+		m := scm.Metrics().AppendEmpty()
+		m.SetName(metric.name)
+		m.SetDescription(metric.desc)
+		m.SetUnit(metric.unit)
+		metric.meta.copyTo(m.Metadata())
+		streams := sel.streams(rp.st, rs)
+		switch metric.type_ {
+		case "Gauge":
+			dps := m.SetEmptyGauge().DataPoints()
+			for _, ms := range streams {
+				for _, pt := range ms.points {
+					rp.setNumberPoint(dps, ms.attr, pt)
+				}
+			}
+		case "Sum":
+			s := m.SetEmptySum()
+			s.SetAggregationTemporality(temporalities[metric.tempo])
+			s.SetIsMonotonic(metric.mono)
+			for _, ms := range streams {
+				for _, pt := range ms.points {
+					rp.setNumberPoint(s.DataPoints(), ms.attr, pt)
+				}
+			}
+		case "Histogram":
+			h := m.SetEmptyHistogram()
+			h.SetAggregationTemporality(temporalities[metric.tempo])
+			for _, ms := range streams {
+				for _, pt := range ms.points {
+					hp := pt.(histogramPoint)
+					dp := h.DataPoints().AppendEmpty()
+					rp.setPoint(hp.point, ms.attr, dp)
+					rp.setHistolike(hp.histolikePoint, dp)
+					dp.BucketCounts().FromRaw(hp.buckets)
+					dp.ExplicitBounds().FromRaw(hp.bounds)
+				}
+			}
+		case "ExponentialHistogram":
+			eh := m.SetEmptyExponentialHistogram()
+			eh.SetAggregationTemporality(temporalities[metric.tempo])
+			for _, ms := range streams {
+				for _, pt := range ms.points {
+					ehp := pt.(exponentialHistogramPoint)
+					dp := eh.DataPoints().AppendEmpty()
+					rp.setPoint(ehp.point, ms.attr, dp)
+					rp.setHistolike(ehp.histolikePoint, dp)
+					dp.SetScale(ehp.scale)
+					dp.SetZeroCount(ehp.zeros)
+					dp.SetZeroThreshold(ehp.zeroThre)
+					dp.Positive().SetOffset(ehp.pos.off)
+					dp.Positive().BucketCounts().FromRaw(ehp.pos.buckets)
+					dp.Negative().SetOffset(ehp.neg.off)
+					dp.Negative().BucketCounts().FromRaw(ehp.neg.buckets)
+				}
+			}
+		case "Summary":
+			dps := m.SetEmptySummary().DataPoints()
+			for _, ms := range streams {
+				for _, pt := range ms.points {
+					sp := pt.(summaryPoint)
+					dp := dps.AppendEmpty()
+					rp.setPoint(sp.point, ms.attr, dp)
+					dp.SetCount(sp.count)
+					dp.SetSum(sp.sum)
+					for _, qv := range sp.quantiles {
+						q := dp.QuantileValues().AppendEmpty()
+						q.SetQuantile(qv.q)
+						q.SetValue(qv.v)
+					}
+				}
+			}
+		}
+
+		if md.DataPointCount() >= replayBatchSize {
+			req := pmetricotlp.NewExportRequestFromMetrics(md)
+			reqs = append(reqs, &req)
+			md = pmetric.NewMetrics()
+			clear(rms)
+			clear(scms)
+		}
+	}
+	if md.DataPointCount() > 0 {
+		req := pmetricotlp.NewExportRequestFromMetrics(md)
+		reqs = append(reqs, &req)
+	}
+	return reqs
+}
+
+// Converts the selected telemetry back to OTLP export requests
+func (st *storage) replayRequests(rr replayRequest) ([]exportRequest, error) {
+	st.Lock()
+	defer st.Unlock()
+	sel, err := st.replaySelection(rr)
+	if err != nil {
+		return nil, requestError{status: http.StatusBadRequest, err: err}
+	}
+	rp := &replayer{st: st}
+	if rr.Now {
+		if latest := sel.latest(st); latest.notEmpty() {
+			rp.shift = time.Now().UnixNano() - int64(latest)
+		}
+	}
+	if rr.NewTraceIds {
+		rp.renameTo = map[traceId]traceId{}
+	}
+	var reqs []exportRequest
+	reqs = append(reqs, rp.traces(sel.traces)...)
+	reqs = append(reqs, rp.logs(sel.logs)...)
+	reqs = append(reqs, rp.metrics(sel)...)
+	return reqs, nil
+}
+
+func (st *storage) replay(ctx context.Context, rr replayRequest) (replayResult, error) {
+	var res replayResult
+	client, err := newOtlpClient(rr.Target, rr.Headers, rr.Compression)
+	if err != nil {
+		return res, requestError{status: http.StatusBadRequest, err: err}
+	}
+	defer client.close()
+
+	reqs, err := st.replayRequests(rr)
+	if err != nil {
+		return res, err
+	}
+	for _, req := range reqs {
+		if err := client.export(ctx, req, nil); err != nil {
+			return res, fmt.Errorf("replay stopped after %d requests: %w", res.requests, err)
+		}
+		res.requests++
+		switch req := req.(type) {
+		case *ptraceotlp.ExportRequest:
+			res.spans += req.Traces().SpanCount()
+		case *plogotlp.ExportRequest:
+			res.logs += req.Logs().LogRecordCount()
+		case *pmetricotlp.ExportRequest:
+			res.points += req.Metrics().DataPointCount()
+		}
+	}
+	return res, nil
+}
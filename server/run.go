@@ -0,0 +1,197 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+type stopFunc func()
+
+func (s stopFunc) stop() {
+	if s != nil {
+		s()
+	}
+}
+
+type Config struct {
+	Listen   string // host or IP address of the endpoints, "" for localhost
+	GrpcPort int    // 0 to disable
+	HttpPort int    // 0 to disable
+	UiPort   int
+	Verbose  bool
+	Capture  bool
+	Ndjson   string // file path, or "-" for stdout
+
+	Self         string
+	SelfInterval time.Duration
+
+	Forward            string
+	ForwardHeaders     map[string]string
+	ForwardCompression string
+	ForwardQueue       int
+
+	Generate     bool
+	GenerateRate float64
+
+	Tui bool
+
+	Messages io.Writer // status messages; stdout by default, or stderr when writing NDJSON to stdout
+
+	TenantHeader string // request header separating tenants, "" to disable
+	TenantLimit  int    // most tenants besides the default one, 0 for unlimited
+
+	RedactRules   []RedactRule // applied to all attributes, in order
+	RedactHeaders []string     // request headers whose values are masked
+
+	SamplePercentage float64       // head sampling, by trace ID
+	SampleRate       float64       // traces per second per service, 0 for unlimited
+	TailWait         time.Duration // for the spans of a trace to arrive before tail sampling it
+	TailErrors       bool          // tail sampling keeps traces with errors
+	TailLatency      time.Duration // tail sampling keeps traces at least this long
+	TailPercentage   float64       // tail sampling keeps this percentage of traces
+
+	ShutdownTimeout time.Duration // for in-flight requests and forwarding to finish
+	FinalExport     string        // file or OTLP endpoint to export everything to when stopping
+
+	// Called on SIGHUP to re-read the config file; only some settings are
+	// applied without a restart, see restartFields
+	Reload func() (Config, error)
+}
+
+// Runs telui until interrupted or terminated
+func Run(cfg Config) error {
+	storage := newStorage(cfg.Verbose, cfg.Capture)
+	if cfg.Messages != nil {
+		storage.messages = cfg.Messages
+	} else if cfg.Ndjson == "-" {
+		storage.messages = os.Stderr
+	}
+	var status *tuiStatus
+	if cfg.Tui {
+		status = &tuiStatus{out: storage.messages}
+		storage.messages = status
+	}
+
+	// Cancelled some time after stopping, to bound the time spent draining
+	drainCtx, cancelDrain := context.WithCancel(context.Background())
+	defer cancelDrain()
+	stopping := false
+
+	redact, err := newRedactor(cfg.RedactRules, cfg.RedactHeaders)
+	if err != nil {
+		return err
+	}
+	storage.redact = redact
+
+	if cfg.Self != "" {
+		selfTel, err := startSelfTelemetry(storage, cfg.Self, cfg.SelfInterval)
+		if err != nil {
+			return err
+		}
+		defer selfTel.stop()
+	}
+
+	if cfg.Ndjson != "" {
+		output, err := startNdjson(storage, cfg.Ndjson)
+		if err != nil {
+			return err
+		}
+		defer output.stop()
+	}
+
+	if cfg.Forward != "" {
+		forwarding, err := startForwarding(storage, cfg.Forward, cfg.ForwardHeaders, cfg.ForwardCompression, cfg.ForwardQueue)
+		if err != nil {
+			return err
+		}
+		defer forwarding.stop()
+		defer storage.forward.drain(drainCtx)
+	}
+
+	if cfg.FinalExport != "" {
+		defer func() {
+			if !stopping {
+				return
+			}
+			if err := finalExport(storage, cfg.FinalExport, cfg.ShutdownTimeout); err != nil {
+				fmt.Fprintf(os.Stderr, "Final export failed: %v\n", err)
+			}
+		}()
+	}
+
+	if cfg.TenantHeader != "" {
+		enableTenants(storage, cfg.TenantHeader, cfg.TenantLimit)
+	}
+
+	sampling := cfg.sampling()
+	if sampling.head < 1 || sampling.rate > 0 || sampling.tail() {
+		defer startSampling(storage, sampling).stop()
+	}
+
+	// Receivers stop first, so nothing is received after the final export
+	if cfg.GrpcPort != 0 {
+		otlpGrpc, _, err := serveOtlpGrpc(storage, cfg.Listen, cfg.GrpcPort)
+		if err != nil {
+			return err
+		}
+		defer otlpGrpc(drainCtx)
+	}
+
+	if cfg.HttpPort != 0 {
+		otlpHttp, _, err := serveOtlpHttp(storage, cfg.Listen, cfg.HttpPort)
+		if err != nil {
+			return err
+		}
+		defer otlpHttp(drainCtx)
+	}
+
+	gen := newGenerator(storage, cfg.GenerateRate)
+	if cfg.Generate {
+		gen.startGenerating()
+	}
+	defer gen.stop()
+
+	if cfg.Reload != nil {
+		hup := make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+		defer signal.Stop(hup)
+		done := make(chan struct{})
+		defer close(done)
+		go func() {
+			for {
+				select {
+				case <-hup:
+					reloadConfig(&cfg, storage, gen)
+				case <-done:
+					return
+				}
+			}
+		}()
+	}
+
+	api, _, err := serveUi(storage, gen, cfg.Listen, cfg.UiPort)
+	if err != nil {
+		return err
+	}
+	defer api(drainCtx)
+	storage.setReady(true)
+
+	if cfg.Tui {
+		runTui(storage, status)
+	} else {
+		c := make(chan os.Signal, 1)
+		signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+		<-c
+	}
+	fmt.Fprintf(storage.messages, "\nStopping.\n")
+	stopping = true
+	storage.setReady(false)
+	time.AfterFunc(cfg.ShutdownTimeout, cancelDrain)
+
+	return nil
+}
@@ -0,0 +1,345 @@
+package server
+
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// How long decisions are remembered, so that spans arriving after their trace
+// was decided get the same fate
+const samplingDecisionTTL = time.Minute
+
+type samplingSettings struct {
+	head        float64 // fraction of traces kept, by trace ID
+	rate        float64 // traces per second per service, 0 for unlimited
+	tailWait    time.Duration
+	tailErrors  bool
+	tailLatency time.Duration
+	tailRatio   float64
+}
+
+func (ss samplingSettings) tail() bool {
+	return ss.tailErrors || ss.tailLatency > 0 || ss.tailRatio > 0
+}
+
+type pendingSpan struct {
+	st      *storage // of the tenant
+	tid     traceId
+	sid     spanId
+	sp      span
+	service string
+}
+
+type pendingTrace struct {
+	first   time.Time
+	spans   []pendingSpan
+	decided bool // kept, and being stored
+}
+
+type samplingDecision struct {
+	st   *storage // of the tenant
+	keep bool
+	time time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type samplingCounts struct {
+	keptBy       map[string]int // traces, by reason
+	droppedBy    map[string]int
+	spansKept    int
+	spansDropped int
+}
+
+// Decides which traces are stored, as a production sampling setup would
+type sampler struct {
+	mutex    sync.Mutex
+	settings samplingSettings
+	pending  map[traceId]*pendingTrace
+	decided  map[traceId]samplingDecision
+	buckets  map[string]*tokenBucket
+	counts   samplingCounts
+	done     chan struct{}
+	wg       sync.WaitGroup
+}
+
+// The same algorithm as the TraceIDRatioBased sampler of the OpenTelemetry SDKs
+func traceIdRatio(tid traceId, fraction float64) bool {
+	if fraction >= 1 {
+		return true
+	}
+	x := binary.BigEndian.Uint64(tid[8:16]) >> 1
+	return x < uint64(fraction*(1<<63))
+}
+
+// Forgets the spans held and the decisions made for a tenant, or everything if
+// st is nil or tenants are not separated
+func (sa *sampler) reset(st *storage) {
+	if sa == nil {
+		return
+	}
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+	if st != nil && st.tenants != nil {
+		for tid, pt := range sa.pending {
+			pt.spans = slices.DeleteFunc(pt.spans, func(ps pendingSpan) bool { return ps.st == st })
+			if len(pt.spans) == 0 {
+				delete(sa.pending, tid)
+			}
+		}
+		maps.DeleteFunc(sa.decided, func(_ traceId, d samplingDecision) bool { return d.st == st })
+		return
+	}
+	sa.pending = map[traceId]*pendingTrace{}
+	sa.decided = map[traceId]samplingDecision{}
+	sa.buckets = map[string]*tokenBucket{}
+	sa.counts = samplingCounts{keptBy: map[string]int{}, droppedBy: map[string]int{}}
+}
+
+// Must be called with the sampler locked
+func (sa *sampler) allowRate(service string, now time.Time) bool {
+	if sa.settings.rate <= 0 {
+		return true
+	}
+	burst := max(sa.settings.rate, 1)
+	b, ok := sa.buckets[service]
+	if !ok {
+		b = &tokenBucket{tokens: burst, last: now}
+		sa.buckets[service] = b
+	}
+	b.tokens = min(burst, b.tokens+now.Sub(b.last).Seconds()*sa.settings.rate)
+	b.last = now
+	if b.tokens < 1 {
+		return false
+	}
+	b.tokens--
+	return true
+}
+
+// Must be called with the sampler locked
+func (sa *sampler) decide(st *storage, tid traceId, keep bool, reason string, spans int, now time.Time) {
+	sa.decided[tid] = samplingDecision{st, keep, now}
+	if keep {
+		sa.counts.keptBy[reason]++
+		sa.counts.spansKept += spans
+	} else {
+		sa.counts.droppedBy[reason]++
+		sa.counts.spansDropped += spans
+	}
+}
+
+// Returns whether the span should be stored right away. With tail sampling,
+// spans are held until their trace is decided.
+func (sa *sampler) admit(st *storage, tid traceId, sid spanId, sp span, service string) bool {
+	if sa == nil {
+		return true
+	}
+	now := time.Now()
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+	if d, ok := sa.decided[tid]; ok {
+		if d.keep {
+			sa.counts.spansKept++
+		} else {
+			sa.counts.spansDropped++
+		}
+		return d.keep
+	}
+	if pt, ok := sa.pending[tid]; ok {
+		pt.spans = append(pt.spans, pendingSpan{st, tid, sid, sp, service})
+		return false
+	}
+	if !traceIdRatio(tid, sa.settings.head) {
+		sa.decide(st, tid, false, "head", 1, now)
+		return false
+	}
+	if sa.settings.tail() {
+		sa.pending[tid] = &pendingTrace{first: now, spans: []pendingSpan{{st, tid, sid, sp, service}}}
+		return false
+	}
+	if !sa.allowRate(service, now) {
+		sa.decide(st, tid, false, "rate limit", 1, now)
+		return false
+	}
+	sa.decide(st, tid, true, "head", 1, now)
+	return true
+}
+
+// Must be called with the sampler locked
+func (sa *sampler) decideTail(tid traceId, pt *pendingTrace, now time.Time) bool {
+	var start, end timestampValue
+	hasError := false
+	st, service := pt.spans[0].st, pt.spans[0].service
+	for _, ps := range pt.spans {
+		if ps.sp.status == "Error" {
+			hasError = true
+		}
+		if start == 0 || ps.sp.start < start {
+			start = ps.sp.start
+		}
+		end = max(end, ps.sp.end)
+		if ps.sp.parent == (spanId{}) {
+			service = ps.service
+		}
+	}
+	reason := ""
+	switch {
+	case sa.settings.tailErrors && hasError:
+		reason = "errors"
+	case sa.settings.tailLatency > 0 && end > start && time.Duration(end-start) >= sa.settings.tailLatency:
+		reason = "latency"
+	case sa.settings.tailRatio > 0 && traceIdRatio(tid, sa.settings.tailRatio):
+		reason = "percentage"
+	}
+	if reason == "" {
+		sa.decide(st, tid, false, "tail policies", len(pt.spans), now)
+		return false
+	}
+	if !sa.allowRate(service, now) {
+		sa.decide(st, tid, false, "rate limit", len(pt.spans), now)
+		return false
+	}
+	sa.decide(st, tid, true, reason, len(pt.spans), now)
+	return true
+}
+
+// Decides the traces which waited long enough, or all of them if flush is set
+func (sa *sampler) tick(flush bool) {
+	now := time.Now()
+	var kept []traceId
+	var spans []pendingSpan
+	sa.mutex.Lock()
+	for tid, pt := range sa.pending {
+		if pt.decided || !flush && now.Sub(pt.first) < sa.settings.tailWait {
+			continue
+		}
+		if sa.decideTail(tid, pt, now) {
+			pt.decided = true
+			kept = append(kept, tid)
+			spans = append(spans, pt.spans...)
+		} else {
+			delete(sa.pending, tid)
+		}
+	}
+	for tid, d := range sa.decided {
+		if now.Sub(d.time) >= samplingDecisionTTL {
+			delete(sa.decided, tid)
+		}
+	}
+	sa.mutex.Unlock()
+
+	// Kept traces stay pending until stored, so that their resources are not
+	// garbage collected in between
+	for _, ps := range spans {
+		ps.st.storeSpan(ps.tid, ps.sid, ps.sp)
+	}
+	sa.mutex.Lock()
+	for _, tid := range kept {
+		delete(sa.pending, tid)
+	}
+	sa.mutex.Unlock()
+}
+
+func (sa *sampler) run() {
+	defer sa.wg.Done()
+	ticker := time.NewTicker(100 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			sa.tick(false)
+		case <-sa.done:
+			return
+		}
+	}
+}
+
+// Pending traces are decided right away, so that they are part of the final export
+func (sa *sampler) stop() {
+	close(sa.done)
+	sa.wg.Wait()
+	sa.tick(true)
+}
+
+// Reports what the spans held for a tenant refer to
+func (sa *sampler) references(st *storage, ref func(reqId, resId, scopeId)) {
+	if sa == nil {
+		return
+	}
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+	for _, pt := range sa.pending {
+		for _, ps := range pt.spans {
+			if ps.st == st {
+				ref(ps.sp.req, ps.sp.res, ps.sp.scope)
+			}
+		}
+	}
+}
+
+type samplingReport struct {
+	samplingCounts
+	pending int
+}
+
+func (sa *sampler) report() *samplingReport {
+	if sa == nil {
+		return nil
+	}
+	sa.mutex.Lock()
+	defer sa.mutex.Unlock()
+	return &samplingReport{
+		samplingCounts: samplingCounts{
+			keptBy:       maps.Clone(sa.counts.keptBy),
+			droppedBy:    maps.Clone(sa.counts.droppedBy),
+			spansKept:    sa.counts.spansKept,
+			spansDropped: sa.counts.spansDropped,
+		},
+		pending: len(sa.pending),
+	}
+}
+
+func (sr *samplingReport) toJson(m *mapifier) {
+	for _, key := range []string{"kept", "dropped"} {
+		counts := sr.keptBy
+		if key == "dropped" {
+			counts = sr.droppedBy
+		}
+		m2 := m.submap(key)
+		for _, reason := range slices.Sorted(maps.Keys(counts)) {
+			m2.pair(reason, intValue(counts[reason]))
+		}
+		m2.done()
+	}
+	m.pair("pending", intValue(sr.pending))
+	m.pair("spans.kept", intValue(sr.spansKept))
+	m.pair("spans.dropped", intValue(sr.spansDropped))
+}
+
+func startSampling(st *storage, settings samplingSettings) stopFunc {
+	sa := &sampler{settings: settings, done: make(chan struct{})}
+	sa.reset(nil)
+	st.sampler = sa
+	var policies []string
+	if settings.head < 1 {
+		policies = append(policies, fmt.Sprintf("%g%% of traces", settings.head*100))
+	}
+	if settings.tail() {
+		policies = append(policies, fmt.Sprintf("tail decisions after %v", settings.tailWait))
+	}
+	if settings.rate > 0 {
+		policies = append(policies, fmt.Sprintf("at most %g traces/s per service", settings.rate))
+	}
+	fmt.Fprintf(st.messages, "Sampling traces: %s\n", strings.Join(policies, ", "))
+	sa.wg.Add(1)
+	go sa.run()
+	return sa.stop
+}
@@ -0,0 +1,56 @@
+package server
+
+import (
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+func TestHeadSampling(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.SamplePercentage = 50
+	st := testStorage(false)
+	stop := startSampling(st, cfg.sampling())
+	defer stop.stop()
+
+	// The ratio is applied to the last 8 bytes of the trace ID, as in the SDKs
+	kept, dropped := testTraceId(1, 0x10), testTraceId(2, 0xf0)
+	receiveTestTraces(t, st, testRequest(), checkoutTrace(dropped, time.Now(), ptrace.StatusCodeOk))
+	receiveTestTraces(t, st, testRequest(), checkoutTrace(kept, time.Now(), ptrace.StatusCodeOk))
+	spans := (&Receiver{st: st}).Spans()
+	for _, s := range spans {
+		if s.TraceID != kept.String() {
+			t.Errorf("span %s of trace %s was not dropped", s.Name, s.TraceID)
+		}
+	}
+	if len(spans) != 2 {
+		t.Errorf("got %d spans, want the 2 spans of the kept trace", len(spans))
+	}
+}
+
+func TestTailSampling(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TailWait = 50 * time.Millisecond
+	cfg.TailErrors = true
+	st := testStorage(false)
+	stop := startSampling(st, cfg.sampling())
+
+	failed, ok := testTraceId(1, 0), testTraceId(2, 0)
+	receiveTestTraces(t, st, testRequest(), checkoutTrace(ok, time.Now(), ptrace.StatusCodeOk))
+	receiveTestTraces(t, st, testRequest(), checkoutTrace(failed, time.Now(), ptrace.StatusCodeError))
+	if n := len((&Receiver{st: st}).Spans()); n != 0 {
+		t.Errorf("got %d spans before the decision, want them held", n)
+	}
+	// Stopping decides on the spans which are still held
+	stop.stop()
+	spans := (&Receiver{st: st}).Spans()
+	if len(spans) != 2 {
+		t.Fatalf("got %d spans, want the 2 spans of the failed trace", len(spans))
+	}
+	for _, s := range spans {
+		if s.TraceID != failed.String() {
+			t.Errorf("span %s of trace %s was not dropped", s.Name, s.TraceID)
+		}
+	}
+}
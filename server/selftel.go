@@ -0,0 +1,487 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"math"
+	"math/rand/v2"
+	"net/http"
+	"os"
+	"slices"
+	"strconv"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+const maxSelfSpans = 1000 // per export interval
+
+type selfInstrument struct {
+	unit   string
+	desc   string
+	bounds []float64 // nil for counters
+}
+
+var durationBounds = []float64{0.1, 0.5, 1, 5, 10, 50, 100, 500, 1000, 5000}
+
+var selfInstruments = map[string]selfInstrument{
+	"telui.receiver.requests": {
+		unit: "{request}",
+		desc: "Number of OTLP export requests received",
+	},
+	"telui.receiver.duration": {
+		unit:   "ms",
+		desc:   "Time taken to handle OTLP export requests",
+		bounds: durationBounds,
+	},
+	"telui.receiver.payload.size": {
+		unit:   "By",
+		desc:   "Size of OTLP export requests as received",
+		bounds: []float64{256, 1024, 4096, 16384, 65536, 262144, 1048576, 4194304},
+	},
+	"telui.ui.requests": {
+		unit: "{request}",
+		desc: "Number of requests to the web interface",
+	},
+	"telui.ui.duration": {
+		unit:   "ms",
+		desc:   "Time taken to handle requests to the web interface",
+		bounds: durationBounds,
+	},
+	"telui.storage.lock.wait": {
+		unit:   "ms",
+		desc:   "Time spent waiting for the storage lock",
+		bounds: []float64{0.001, 0.01, 0.1, 1, 10, 100},
+	},
+}
+
+type selfLabel struct {
+	k string
+	v string
+}
+
+type selfKey struct {
+	name   string
+	labels [3]selfLabel
+}
+
+func makeSelfKey(name string, labels ...selfLabel) selfKey {
+	key := selfKey{name: name}
+	copy(key.labels[:], labels)
+	return key
+}
+
+type selfHistogram struct {
+	count   uint64
+	sum     float64
+	min     float64
+	max     float64
+	buckets []uint64
+}
+
+type selfSpan struct {
+	name   string
+	kind   ptrace.SpanKind
+	start  time.Time
+	end    time.Time
+	labels []selfLabel
+	err    string
+}
+
+type selfTelemetry struct {
+	sync.Mutex
+	start        time.Time
+	counts       map[selfKey]int64
+	histos       map[selfKey]*selfHistogram
+	spans        []selfSpan
+	droppedSpans int
+}
+
+func newSelfTelemetry() *selfTelemetry {
+	return &selfTelemetry{
+		start:  time.Now(),
+		counts: map[selfKey]int64{},
+		histos: map[selfKey]*selfHistogram{},
+	}
+}
+
+// All recording methods are no-ops on a nil receiver, so that callers do not
+// need to check whether self-telemetry is enabled.
+
+func (s *selfTelemetry) add(name string, n int64, labels ...selfLabel) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	s.counts[makeSelfKey(name, labels...)] += n
+}
+
+func (s *selfTelemetry) observe(name string, v float64, labels ...selfLabel) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	key := makeSelfKey(name, labels...)
+	h, ok := s.histos[key]
+	if !ok {
+		h = &selfHistogram{
+			min:     v,
+			max:     v,
+			buckets: make([]uint64, len(selfInstruments[name].bounds)+1),
+		}
+		s.histos[key] = h
+	}
+	h.count++
+	h.sum += v
+	h.min = math.Min(h.min, v)
+	h.max = math.Max(h.max, v)
+	bucket, _ := slices.BinarySearch(selfInstruments[name].bounds, v)
+	h.buckets[bucket]++
+}
+
+func (s *selfTelemetry) span(sp selfSpan) {
+	if s == nil {
+		return
+	}
+	s.Lock()
+	defer s.Unlock()
+	if len(s.spans) >= maxSelfSpans {
+		s.droppedSpans++
+		return
+	}
+	s.spans = append(s.spans, sp)
+}
+
+func durationMs(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+func (s *selfTelemetry) recordReceive(transport string, signal string, peer string, start time.Time, end time.Time, size int, errMsg string) {
+	if s == nil {
+		return
+	}
+	outcome := "ok"
+	if errMsg != "" {
+		outcome = "rejected"
+	}
+	s.add("telui.receiver.requests", 1, selfLabel{"transport", transport}, selfLabel{"signal", signal}, selfLabel{"outcome", outcome})
+	s.observe("telui.receiver.duration", durationMs(end.Sub(start)), selfLabel{"transport", transport}, selfLabel{"signal", signal})
+	s.observe("telui.receiver.payload.size", float64(size), selfLabel{"transport", transport}, selfLabel{"signal", signal})
+	s.span(selfSpan{
+		name:  "Export " + signal,
+		kind:  ptrace.SpanKindServer,
+		start: start,
+		end:   end,
+		labels: []selfLabel{
+			{"telui.transport", transport},
+			{"telui.signal", signal},
+			{"client.address", peer},
+			{"telui.payload.size", strconv.Itoa(size)},
+		},
+		err: errMsg,
+	})
+}
+
+func (s *selfTelemetry) recordUi(route string, status int, start time.Time, end time.Time) {
+	if s == nil {
+		return
+	}
+	s.add("telui.ui.requests", 1, selfLabel{"http.route", route}, selfLabel{"http.response.status_code", strconv.Itoa(status)})
+	s.observe("telui.ui.duration", durationMs(end.Sub(start)), selfLabel{"http.route", route})
+	var errMsg string
+	if status >= 500 {
+		errMsg = http.StatusText(status)
+	}
+	s.span(selfSpan{
+		name:  route,
+		kind:  ptrace.SpanKindServer,
+		start: start,
+		end:   end,
+		labels: []selfLabel{
+			{"http.route", route},
+			{"http.response.status_code", strconv.Itoa(status)},
+		},
+		err: errMsg,
+	})
+}
+
+func (s *selfTelemetry) recordLockWait(d time.Duration) {
+	if s == nil {
+		return
+	}
+	s.observe("telui.storage.lock.wait", durationMs(d))
+}
+
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (sr *statusRecorder) WriteHeader(status int) {
+	if sr.status == 0 {
+		sr.status = status
+	}
+	sr.ResponseWriter.WriteHeader(status)
+}
+
+func (sr *statusRecorder) Write(b []byte) (int, error) {
+	if sr.status == 0 {
+		sr.status = http.StatusOK
+	}
+	return sr.ResponseWriter.Write(b)
+}
+
+func (s *selfTelemetry) instrumentHttp(h http.Handler, record func(r *http.Request, status int, size int, start time.Time, end time.Time)) http.Handler {
+	if s == nil {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		body := &countingReadCloser{countingReader{Reader: r.Body}, r.Body}
+		r.Body = body
+		sr := &statusRecorder{ResponseWriter: w}
+		h.ServeHTTP(sr, r)
+		if sr.status == 0 {
+			sr.status = http.StatusOK
+		}
+		record(r, sr.status, body.n, start, time.Now())
+	})
+}
+
+func setSelfResource(res pcommon.Resource) {
+	res.Attributes().PutStr("service.name", "telui")
+	res.Attributes().PutStr("telemetry.sdk.name", "telui")
+	res.Attributes().PutStr("telemetry.sdk.language", "go")
+	if host, err := os.Hostname(); err == nil {
+		res.Attributes().PutStr("host.name", host)
+	}
+}
+
+func putSelfLabels(m pcommon.Map, labels []selfLabel) {
+	for _, l := range labels {
+		if l.k != "" {
+			m.PutStr(l.k, l.v)
+		}
+	}
+}
+
+func (s *selfTelemetry) collectMetrics(now time.Time, sizes map[string]int) pmetric.Metrics {
+	s.Lock()
+	defer s.Unlock()
+
+	md := pmetric.NewMetrics()
+	rm := md.ResourceMetrics().AppendEmpty()
+	setSelfResource(rm.Resource())
+	sm := rm.ScopeMetrics().AppendEmpty()
+	sm.Scope().SetName("github.com/jade-guiton/telui")
+
+	startTs := pcommon.NewTimestampFromTime(s.start)
+	nowTs := pcommon.NewTimestampFromTime(now)
+
+	for _, name := range slices.Sorted(maps.Keys(selfInstruments)) {
+		inst := selfInstruments[name]
+		m := pmetric.NewMetric()
+		m.SetName(name)
+		m.SetUnit(inst.unit)
+		m.SetDescription(inst.desc)
+		if inst.bounds == nil {
+			sum := m.SetEmptySum()
+			sum.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			sum.SetIsMonotonic(true)
+			for key, n := range s.counts {
+				if key.name != name {
+					continue
+				}
+				dp := sum.DataPoints().AppendEmpty()
+				putSelfLabels(dp.Attributes(), key.labels[:])
+				dp.SetStartTimestamp(startTs)
+				dp.SetTimestamp(nowTs)
+				dp.SetIntValue(n)
+			}
+			if sum.DataPoints().Len() == 0 {
+				continue
+			}
+		} else {
+			histo := m.SetEmptyHistogram()
+			histo.SetAggregationTemporality(pmetric.AggregationTemporalityCumulative)
+			for key, h := range s.histos {
+				if key.name != name {
+					continue
+				}
+				dp := histo.DataPoints().AppendEmpty()
+				putSelfLabels(dp.Attributes(), key.labels[:])
+				dp.SetStartTimestamp(startTs)
+				dp.SetTimestamp(nowTs)
+				dp.SetCount(h.count)
+				dp.SetSum(h.sum)
+				dp.SetMin(h.min)
+				dp.SetMax(h.max)
+				dp.ExplicitBounds().FromRaw(inst.bounds)
+				dp.BucketCounts().FromRaw(h.buckets)
+			}
+			if histo.DataPoints().Len() == 0 {
+				continue
+			}
+		}
+		m.MoveTo(sm.Metrics().AppendEmpty())
+	}
+
+	m := sm.Metrics().AppendEmpty()
+	m.SetName("telui.storage.items")
+	m.SetUnit("{item}")
+	m.SetDescription("Number of items held in storage")
+	gauge := m.SetEmptyGauge()
+	for _, kind := range slices.Sorted(maps.Keys(sizes)) {
+		dp := gauge.DataPoints().AppendEmpty()
+		dp.Attributes().PutStr("telui.item.kind", kind)
+		dp.SetTimestamp(nowTs)
+		dp.SetIntValue(int64(sizes[kind]))
+	}
+
+	return md
+}
+
+func (s *selfTelemetry) collectTraces() ptrace.Traces {
+	s.Lock()
+	spans := s.spans
+	dropped := s.droppedSpans
+	s.spans = nil
+	s.droppedSpans = 0
+	s.Unlock()
+
+	td := ptrace.NewTraces()
+	if len(spans) == 0 {
+		return td
+	}
+	if dropped > 0 {
+		fmt.Fprintf(os.Stderr, "Warning: dropped %d self-telemetry spans\n", dropped)
+	}
+	rs := td.ResourceSpans().AppendEmpty()
+	setSelfResource(rs.Resource())
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("github.com/jade-guiton/telui")
+	for _, sp := range spans {
+		sp2 := ss.Spans().AppendEmpty()
+		var tid pcommon.TraceID
+		var sid pcommon.SpanID
+		randomBytes(tid[:])
+		randomBytes(sid[:])
+		sp2.SetTraceID(tid)
+		sp2.SetSpanID(sid)
+		sp2.SetName(sp.name)
+		sp2.SetKind(sp.kind)
+		sp2.SetStartTimestamp(pcommon.NewTimestampFromTime(sp.start))
+		sp2.SetEndTimestamp(pcommon.NewTimestampFromTime(sp.end))
+		putSelfLabels(sp2.Attributes(), sp.labels)
+		if sp.err != "" {
+			sp2.Status().SetCode(ptrace.StatusCodeError)
+			sp2.Status().SetMessage(sp.err)
+		}
+	}
+	return td
+}
+
+func randomBytes(b []byte) {
+	for i := range b {
+		b[i] = byte(rand.Uint32())
+	}
+}
+
+func (st *storage) storageSizes() map[string]int {
+	st.Lock()
+	defer st.Unlock()
+	sizes := map[string]int{
+		"traces":    len(st.traces),
+		"logs":      len(st.logs),
+		"metrics":   len(st.metrics),
+		"profiles":  len(st.profiles),
+		"calls":     len(st.calls),
+		"resources": len(st.resources),
+		"scopes":    len(st.scopes),
+	}
+	for _, tr := range st.traces {
+		sizes["spans"] += len(tr.spans)
+	}
+	for _, m := range st.metrics {
+		for _, ms := range m.streams {
+			sizes["metric.points"] += len(ms.points)
+		}
+	}
+	return sizes
+}
+
+func startSelfTelemetry(st *storage, target string, interval time.Duration) (stopFunc, error) {
+	var client *otlpClient
+	if target != "local" {
+		var err error
+		client, err = newOtlpClient(target, nil, "")
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	self := newSelfTelemetry()
+	st.self = self
+
+	flush := func() {
+		md := self.collectMetrics(time.Now(), st.storageSizes())
+		td := self.collectTraces()
+		if client == nil {
+			st.receiveMetrics(md, requestMeta{transport: "self"}, payload{})
+			if td.SpanCount() > 0 {
+				st.receiveTraces(td, requestMeta{transport: "self"}, payload{})
+			}
+			return
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), interval)
+		defer cancel()
+		mreq := pmetricotlp.NewExportRequestFromMetrics(md)
+		if err := client.export(ctx, &mreq, nil); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to export self-telemetry metrics: %v\n", err)
+		}
+		if td.SpanCount() > 0 {
+			treq := ptraceotlp.NewExportRequestFromTraces(td)
+			if err := client.export(ctx, &treq, nil); err != nil {
+				fmt.Fprintf(os.Stderr, "Failed to export self-telemetry traces: %v\n", err)
+			}
+		}
+	}
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				flush()
+			case <-done:
+				return
+			}
+		}
+	}()
+
+	if client == nil {
+		fmt.Fprintf(st.messages, "Storing self-telemetry locally every %v\n", interval)
+	} else {
+		fmt.Fprintf(st.messages, "Exporting self-telemetry to %s every %v\n", target, interval)
+	}
+	return func() {
+		close(done)
+		<-stopped
+		if client != nil {
+			flush()
+			client.close()
+		}
+	}, nil
+}
@@ -0,0 +1,191 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/reflection"
+	"google.golang.org/grpc/stats"
+	"google.golang.org/grpc/status"
+
+	_ "google.golang.org/grpc/encoding/gzip"
+)
+
+type grpcPayloadKey struct{}
+
+type grpcPayload struct {
+	payload
+	begin  time.Time
+	signal string
+	req    requestMeta
+}
+
+var grpcSignals = map[string]string{
+	"/opentelemetry.proto.collector.trace.v1.TraceService/Export":                  "traces",
+	"/opentelemetry.proto.collector.logs.v1.LogsService/Export":                    "logs",
+	"/opentelemetry.proto.collector.metrics.v1.MetricsService/Export":              "metrics",
+	"/opentelemetry.proto.collector.profiles.v1development.ProfilesService/Export": "profiles",
+}
+
+type grpcStatsHandler struct {
+	st *storage
+}
+
+func (grpcStatsHandler) TagRPC(ctx context.Context, info *stats.RPCTagInfo) context.Context {
+	// Health checks and reflection are not telemetry, so are not recorded
+	if strings.HasPrefix(info.FullMethodName, "/grpc.health.v1.") || strings.HasPrefix(info.FullMethodName, "/grpc.reflection.") {
+		return ctx
+	}
+	return context.WithValue(ctx, grpcPayloadKey{}, &grpcPayload{
+		payload: payload{contentType: "application/grpc"},
+	})
+}
+
+func (h grpcStatsHandler) HandleRPC(ctx context.Context, s stats.RPCStats) {
+	pl, ok := ctx.Value(grpcPayloadKey{}).(*grpcPayload)
+	if !ok {
+		return
+	}
+	switch s := s.(type) {
+	case *stats.Begin:
+		pl.begin = s.BeginTime
+	case *stats.InHeader:
+		pl.encoding = s.Compression
+		pl.signal = grpcSignals[s.FullMethod]
+		if pl.signal == "" {
+			pl.signal = s.FullMethod
+		}
+		pl.req.transport = "grpc"
+		if s.RemoteAddr != nil {
+			pl.req.peer = s.RemoteAddr.String()
+		}
+		pl.req.headers = s.Header.Copy()
+	case *stats.InPayload:
+		pl.wireSize = s.CompressedLength
+		pl.size = s.Length
+		// gRPC decodes the request before we see it, so this includes receiving the body
+		pl.decodeTime = s.RecvTime.Sub(pl.begin)
+	case *stats.End:
+		var errMsg string
+		if s.Error != nil {
+			errMsg = s.Error.Error()
+			fmt.Fprintf(os.Stderr, "Invalid gRPC %s request from %s: %v\n", pl.signal, pl.req.peer, s.Error)
+			h.st.tenantOf(pl.req).receiveRejection(pl.signal, pl.req, pl.payload, status.Code(s.Error).String(), s.Error)
+		}
+		h.st.self.recordReceive("grpc", pl.signal, pl.req.peer, s.BeginTime, s.EndTime, pl.wireSize, errMsg)
+	}
+}
+
+func (grpcStatsHandler) TagConn(ctx context.Context, _ *stats.ConnTagInfo) context.Context {
+	return ctx
+}
+
+func (grpcStatsHandler) HandleConn(context.Context, stats.ConnStats) {}
+
+func getGrpcPayload(ctx context.Context, st *storage, req responseObject) payload {
+	var pl payload
+	if pl2, ok := ctx.Value(grpcPayloadKey{}).(*grpcPayload); ok {
+		pl = pl2.payload
+	}
+	if st.capture.Load() {
+		// The original bytes are not exposed by gRPC, so re-encode the request
+		pl.body, _ = req.MarshalProto()
+	}
+	return pl
+}
+
+type traceServer struct {
+	ptraceotlp.UnimplementedGRPCServer
+	st *storage
+}
+
+func (ts *traceServer) Export(ctx context.Context, req ptraceotlp.ExportRequest) (ptraceotlp.ExportResponse, error) {
+	meta := grpcRequest(ctx)
+	ts.st.tenantOf(meta).receiveTraces(req.Traces(), meta, getGrpcPayload(ctx, ts.st, req))
+	ts.st.forward.enqueue(&req, ts.st.tenantHeaders(meta))
+	return ptraceotlp.NewExportResponse(), nil
+}
+
+type logServer struct {
+	plogotlp.UnimplementedGRPCServer
+	st *storage
+}
+
+func (ls *logServer) Export(ctx context.Context, req plogotlp.ExportRequest) (plogotlp.ExportResponse, error) {
+	meta := grpcRequest(ctx)
+	ls.st.tenantOf(meta).receiveLogs(req.Logs(), meta, getGrpcPayload(ctx, ls.st, req))
+	ls.st.forward.enqueue(&req, ls.st.tenantHeaders(meta))
+	return plogotlp.NewExportResponse(), nil
+}
+
+type metricServer struct {
+	pmetricotlp.UnimplementedGRPCServer
+	st *storage
+}
+
+func (ms *metricServer) Export(ctx context.Context, req pmetricotlp.ExportRequest) (pmetricotlp.ExportResponse, error) {
+	meta := grpcRequest(ctx)
+	ms.st.tenantOf(meta).receiveMetrics(req.Metrics(), meta, getGrpcPayload(ctx, ms.st, req))
+	ms.st.forward.enqueue(&req, ms.st.tenantHeaders(meta))
+	return pmetricotlp.NewExportResponse(), nil
+}
+
+type profileServer struct {
+	pprofileotlp.UnimplementedGRPCServer
+	st *storage
+}
+
+func (ps *profileServer) Export(ctx context.Context, req pprofileotlp.ExportRequest) (pprofileotlp.ExportResponse, error) {
+	meta := grpcRequest(ctx)
+	ps.st.tenantOf(meta).receiveProfiles(req.Profiles(), meta, getGrpcPayload(ctx, ps.st, req))
+	ps.st.forward.enqueue(&req, ps.st.tenantHeaders(meta))
+	return pprofileotlp.NewExportResponse(), nil
+}
+
+func serveOtlpGrpc(storage *storage, host string, port int) (drainFunc, int, error) {
+	grpcServer := grpc.NewServer(grpc.StatsHandler(grpcStatsHandler{st: storage}))
+	ptraceotlp.RegisterGRPCServer(grpcServer, &traceServer{st: storage})
+	plogotlp.RegisterGRPCServer(grpcServer, &logServer{st: storage})
+	pmetricotlp.RegisterGRPCServer(grpcServer, &metricServer{st: storage})
+	pprofileotlp.RegisterGRPCServer(grpcServer, &profileServer{st: storage})
+
+	// The standard health service reports "" for the server as a whole, which
+	// is serving as long as it is up like /healthz, and each OTLP service, which
+	// is serving when telui is ready like /readyz
+	healthServer := health.NewServer()
+	services := slices.Collect(maps.Keys(grpcServer.GetServiceInfo()))
+	setStatus := func(ready bool) {
+		status := healthpb.HealthCheckResponse_NOT_SERVING
+		if ready {
+			status = healthpb.HealthCheckResponse_SERVING
+		}
+		for _, name := range services {
+			healthServer.SetServingStatus(name, status)
+		}
+	}
+	setStatus(storage.ready.Load())
+	storage.readyFuncs = append(storage.readyFuncs, setStatus)
+	healthpb.RegisterHealthServer(grpcServer, healthServer)
+	reflection.Register(grpcServer)
+
+	port, err := listenAndServe(storage, grpcServer, "OTLP/gRPC", host, port)
+	if err != nil {
+		return nil, 0, err
+	}
+	return func(ctx context.Context) {
+		healthServer.Shutdown()
+		drainWithin(ctx, grpcServer.GracefulStop, grpcServer.Stop)
+	}, port, nil
+}
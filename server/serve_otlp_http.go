@@ -0,0 +1,222 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+func writeError(w http.ResponseWriter, status int) {
+	w.Header().Set("Content-Type", "text/plain")
+	w.WriteHeader(status)
+	w.Write([]byte(http.StatusText(status)))
+}
+
+type requestError struct {
+	status int
+	err    error
+}
+
+func (re requestError) Error() string {
+	return re.err.Error()
+}
+func (re requestError) Unwrap() error {
+	return re.err
+}
+
+func rejectRequest(w http.ResponseWriter, status int, err error) error {
+	writeError(w, status)
+	return requestError{status: status, err: err}
+}
+
+func requestErrorStatus(err error) string {
+	var re requestError
+	if errors.As(err, &re) {
+		return fmt.Sprintf("%d %s", re.status, http.StatusText(re.status))
+	}
+	return ""
+}
+
+type requestObject interface {
+	UnmarshalProto([]byte) error
+	UnmarshalJSON([]byte) error
+}
+type responseObject interface {
+	MarshalProto() ([]byte, error)
+	MarshalJSON() ([]byte, error)
+}
+type responder func() error
+
+func readOtlpRequest(w http.ResponseWriter, r *http.Request, req requestObject, res responseObject) (payload, responder, error) {
+	var pl payload
+	if r.Method != http.MethodPost {
+		return pl, nil, rejectRequest(w, http.StatusMethodNotAllowed, fmt.Errorf("HTTP method not allowed"))
+	}
+
+	var body []byte
+	var err error
+	wire := &countingReader{Reader: r.Body}
+	pl.encoding = r.Header.Get("Content-Encoding")
+	switch pl.encoding {
+	case "":
+		body, err = io.ReadAll(wire)
+	case "gzip":
+		var reader *gzip.Reader
+		reader, err = gzip.NewReader(wire)
+		if err == nil {
+			body, err = io.ReadAll(reader)
+		}
+	default:
+		return pl, nil, rejectRequest(w, http.StatusBadRequest, fmt.Errorf("unsupported encoding %q", pl.encoding))
+	}
+	if err == nil {
+		err = r.Body.Close()
+	} else {
+		_ = r.Body.Close()
+	}
+	if err != nil {
+		return pl, nil, rejectRequest(w, http.StatusBadRequest, err)
+	}
+	pl.wireSize = wire.n
+	pl.size = len(body)
+	pl.body = body
+
+	contentType := r.Header.Get("Content-Type")
+	pl.contentType = contentType
+	decodeStart := time.Now()
+	switch contentType {
+	case "application/x-protobuf":
+		err = req.UnmarshalProto(body)
+	case "application/json":
+		err = req.UnmarshalJSON(body)
+	default:
+		return pl, nil, rejectRequest(w, http.StatusUnsupportedMediaType, fmt.Errorf("unsupported content type %q", contentType))
+	}
+	pl.decodeTime = time.Since(decodeStart)
+	if err != nil {
+		return pl, nil, rejectRequest(w, http.StatusBadRequest, err)
+	}
+
+	return pl, func() error {
+		var resBody []byte
+		var err error
+		switch contentType {
+		case "application/x-protobuf":
+			resBody, err = res.MarshalProto()
+		case "application/json":
+			resBody, err = res.MarshalJSON()
+		}
+		if err != nil {
+			writeError(w, http.StatusInternalServerError)
+			return err
+		}
+		w.Header().Set("Content-Type", contentType)
+		_, err = w.Write(resBody)
+		return err
+	}, nil
+}
+
+func serveOtlpHttp(storage *storage, host string, port int) (drainFunc, int, error) {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/v1/traces", func(w http.ResponseWriter, r *http.Request) {
+		req := ptraceotlp.NewExportRequest()
+		res := ptraceotlp.NewExportResponse()
+		meta := httpRequest(r)
+		pl, ack, err := readOtlpRequest(w, r, &req, &res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid trace request from %s: %v\n", r.RemoteAddr, err)
+			storage.tenantOf(meta).receiveRejection("traces", meta, pl, requestErrorStatus(err), err)
+			return
+		}
+		storage.tenantOf(meta).receiveTraces(req.Traces(), meta, pl)
+		storage.forward.enqueue(&req, storage.tenantHeaders(meta))
+		if err = ack(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to respond to %s: %v\n", r.RemoteAddr, err)
+		}
+	})
+
+	mux.HandleFunc("/v1/logs", func(w http.ResponseWriter, r *http.Request) {
+		req := plogotlp.NewExportRequest()
+		res := plogotlp.NewExportResponse()
+		meta := httpRequest(r)
+		pl, ack, err := readOtlpRequest(w, r, &req, &res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid log request from %s: %v\n", r.RemoteAddr, err)
+			storage.tenantOf(meta).receiveRejection("logs", meta, pl, requestErrorStatus(err), err)
+			return
+		}
+		storage.tenantOf(meta).receiveLogs(req.Logs(), meta, pl)
+		storage.forward.enqueue(&req, storage.tenantHeaders(meta))
+		if err = ack(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to respond to %s: %v\n", r.RemoteAddr, err)
+		}
+	})
+	mux.HandleFunc("/v1/metrics", func(w http.ResponseWriter, r *http.Request) {
+		req := pmetricotlp.NewExportRequest()
+		res := pmetricotlp.NewExportResponse()
+		meta := httpRequest(r)
+		pl, ack, err := readOtlpRequest(w, r, &req, &res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid metric request from %s: %v\n", r.RemoteAddr, err)
+			storage.tenantOf(meta).receiveRejection("metrics", meta, pl, requestErrorStatus(err), err)
+			return
+		}
+		storage.tenantOf(meta).receiveMetrics(req.Metrics(), meta, pl)
+		storage.forward.enqueue(&req, storage.tenantHeaders(meta))
+		if err = ack(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to respond to %s: %v\n", r.RemoteAddr, err)
+		}
+	})
+	mux.HandleFunc("/v1development/profiles", func(w http.ResponseWriter, r *http.Request) {
+		req := pprofileotlp.NewExportRequest()
+		res := pprofileotlp.NewExportResponse()
+		meta := httpRequest(r)
+		pl, ack, err := readOtlpRequest(w, r, &req, &res)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Invalid profile request from %s: %v\n", r.RemoteAddr, err)
+			storage.tenantOf(meta).receiveRejection("profiles", meta, pl, requestErrorStatus(err), err)
+			return
+		}
+		storage.tenantOf(meta).receiveProfiles(req.Profiles(), meta, pl)
+		storage.forward.enqueue(&req, storage.tenantHeaders(meta))
+		if err = ack(); err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to respond to %s: %v\n", r.RemoteAddr, err)
+		}
+	})
+
+	handler := storage.self.instrumentHttp(mux, func(r *http.Request, status int, size int, start time.Time, end time.Time) {
+		signal := r.URL.Path
+		for signal2, path := range otlpHttpPaths {
+			if path == r.URL.Path {
+				signal = signal2
+			}
+		}
+		var errMsg string
+		if status >= 400 {
+			errMsg = http.StatusText(status)
+		}
+		storage.self.recordReceive("http", signal, r.RemoteAddr, start, end, size, errMsg)
+	})
+
+	server := http.Server{Handler: withHealth(storage, handler)}
+	port, err := listenAndServe(storage, &server, "OTLP/HTTP", host, port)
+	if err != nil {
+		return nil, 0, err
+	}
+	return func(ctx context.Context) {
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+	}, port, nil
+}
@@ -0,0 +1,753 @@
+package server
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/jade-guiton/telui/static"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/pprofile/pprofileotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+func writeGzipJson(w http.ResponseWriter, producer func(io.Writer)) {
+	hd := w.Header()
+	hd.Set("Content-Type", "application/json")
+	hd.Set("Content-Encoding", "gzip")
+	w2 := gzip.NewWriter(w)
+	defer w2.Flush()
+	w3 := bufio.NewWriter(w2)
+	defer w3.Flush()
+	producer(w3)
+}
+
+func parseTraceId(traceIdStr string) (traceId, bool) {
+	traceIdBytes, err := hex.DecodeString(traceIdStr)
+	if err != nil || len(traceIdBytes) != 16 {
+		return traceId{}, false
+	}
+	return traceId(traceIdBytes), true
+}
+
+func parseSpanId(traceIdStr string, spanIdStr string) (traceId, spanId, bool) {
+	tid, ok := parseTraceId(traceIdStr)
+	if !ok {
+		return traceId{}, spanId{}, false
+	}
+	spanIdBytes, err := hex.DecodeString(spanIdStr)
+	if err != nil || len(spanIdBytes) != 8 {
+		return traceId{}, spanId{}, false
+	}
+	sid := spanId(spanIdBytes)
+	return tid, sid, true
+}
+
+func parseHashId(hashIdStr string) (uint64, bool) {
+	hashIdBytes, err := hex.DecodeString(hashIdStr)
+	if err != nil || len(hashIdBytes) != 8 {
+		return 0, false
+	}
+	hid := binary.BigEndian.Uint64(hashIdBytes)
+	return hid, true
+}
+
+type exportRequest interface {
+	requestObject
+	responseObject
+}
+
+func newExportRequest(signal string) exportRequest {
+	switch signal {
+	case "traces":
+		req := ptraceotlp.NewExportRequest()
+		return &req
+	case "logs":
+		req := plogotlp.NewExportRequest()
+		return &req
+	case "metrics":
+		req := pmetricotlp.NewExportRequest()
+		return &req
+	case "profiles":
+		req := pprofileotlp.NewExportRequest()
+		return &req
+	default:
+		panic("unknown signal")
+	}
+}
+
+func payloadToJson(signal string, pl payload) ([]byte, error) {
+	if pl.contentType == "application/json" {
+		return pl.body, nil
+	}
+	req := newExportRequest(signal)
+	if err := req.UnmarshalProto(pl.body); err != nil {
+		return nil, err
+	}
+	return req.MarshalJSON()
+}
+
+// The API of one tenant
+func uiMux(st *storage, gen *generator) *http.ServeMux {
+	mux := http.NewServeMux()
+
+	mux.Handle("GET /", http.FileServerFS(static.StaticFs))
+
+	mux.HandleFunc("GET /api/traces", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseItemFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			st.Lock()
+			defer st.Unlock()
+			for id, tr := range st.traces {
+				if f != nil {
+					matched := &trace{spans: map[spanId]span{}}
+					for sid, sp := range tr.spans {
+						if f.matchSpan(st, id, sp) {
+							matched.spans[sid] = sp
+						}
+					}
+					if len(matched.spans) == 0 {
+						continue
+					}
+					tr = matched
+				}
+				m.pair(id.toString(), tr)
+			}
+		})
+	})
+	mux.HandleFunc("GET /api/span/{traceId}/{spanId}", func(w http.ResponseWriter, r *http.Request) {
+		tid, sid, ok := parseSpanId(r.PathValue("traceId"), r.PathValue("spanId"))
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		defer st.Unlock()
+		trace, ok := st.traces[tid]
+		var span span
+		if ok {
+			span, ok = trace.spans[sid]
+		}
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			m.pair("span", span)
+			m.pair("scope", st.scopes[span.scope])
+			m.pair("resource", st.resources[span.res])
+			m.pair("request", st.requests[span.req])
+			if p, ok := st.pins[tracePin(tid)]; ok {
+				m2 := m.submap("pin")
+				p.toJson(&m2)
+				m2.done()
+			}
+			a := m.array("logs")
+			for _, log := range st.logsOf(tid, sid) {
+				logListItem(&a, log)
+			}
+			a.done()
+			m.pair("trace.logs", intValue(len(st.traceLogs[tid])))
+			m.done()
+		})
+	})
+	mux.HandleFunc("GET /api/trace/{traceId}/logs", func(w http.ResponseWriter, r *http.Request) {
+		tid, ok := parseTraceId(r.PathValue("traceId"))
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			a := arrayify(w)
+			st.Lock()
+			defer st.Unlock()
+			for _, log := range st.logsOf(tid, spanId{}) {
+				logListItem(&a, log)
+			}
+			a.done()
+		})
+	})
+
+	mux.HandleFunc("GET /api/logs", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseItemFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			a := arrayify(w)
+			st.Lock()
+			defer st.Unlock()
+			for _, log := range st.logs {
+				if !f.matchLog(st, log) {
+					continue
+				}
+				m := a.submap()
+				m.pair("id", intValue(log.id))
+				log.logSummary.toJson(&m)
+				m.done()
+			}
+			a.done()
+		})
+	})
+	mux.HandleFunc("GET /api/log/{logId}", func(w http.ResponseWriter, r *http.Request) {
+		logIdStr := r.PathValue("logId")
+		logId, err := strconv.Atoi(logIdStr)
+		if err != nil || logId < 0 {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		defer st.Unlock()
+		i, ok := st.logIndex(logId)
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			log := st.logs[i]
+			m.pair("log", log)
+			m.pair("scope", st.scopes[log.scope])
+			m.pair("resource", st.resources[log.res])
+			m.pair("request", st.requests[log.req])
+			if p, ok := st.pins[logPin(logId)]; ok {
+				m2 := m.submap("pin")
+				p.toJson(&m2)
+				m2.done()
+			}
+		})
+	})
+
+	mux.HandleFunc("GET /api/metrics", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseItemFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			st.Lock()
+			defer st.Unlock()
+
+			m2 := m.submap("metrics")
+			for mid, metric := range st.metrics {
+				if !f.matchMetric(st, metric) {
+					continue
+				}
+				m3 := m2.submap(hashToString(uint64(mid)))
+				metric.metricIdentity.toJson(&m3)
+				m3.pair("desc", stringValue(metric.desc))
+				m3.done()
+			}
+			m2.done()
+
+			m2 = m.submap("resources")
+			for rid, res := range st.resources {
+				m2.pair(hashToString(uint64(rid)), res)
+			}
+			m2.done()
+
+			m2 = m.submap("scopes")
+			for sid, res := range st.scopes {
+				m2.pair(hashToString(uint64(sid)), res)
+			}
+			m2.done()
+
+			m.done()
+		})
+	})
+	mux.HandleFunc("GET /api/metric/{metricId}", func(w http.ResponseWriter, r *http.Request) {
+		mid, ok := parseHashId(r.PathValue("metricId"))
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		defer st.Unlock()
+		metric, ok := st.metrics[hashId(mid)]
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		requests := map[reqId]struct{}{}
+		traces := map[traceId]bool{}
+		for _, stream := range metric.streams {
+			for _, pt := range stream.points {
+				requests[pt.getPoint().req] = struct{}{}
+				for _, e := range pointExemplars(pt) {
+					if e.trace.notEmpty() {
+						_, traces[e.trace] = st.traces[e.trace]
+					}
+				}
+			}
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			m.pair("metric", metric)
+			m.pair("resource", st.resources[metric.res])
+			m2 := m.submap("requests")
+			for reqId, _ := range requests {
+				m2.pair(hashToString(uint64(reqId)), st.requests[reqId])
+			}
+			m2.done()
+			// Whether the traces of the exemplars were received
+			m2 = m.submap("exemplar.traces")
+			for tid, received := range traces {
+				m2.pair(tid.toString(), boolValue(received))
+			}
+			m2.done()
+			if p, ok := st.pins[metricPin(hashId(mid))]; ok {
+				m2 := m.submap("pin")
+				p.toJson(&m2)
+				m2.done()
+			}
+			m.done()
+		})
+	})
+
+	mux.HandleFunc("GET /api/profiles", func(w http.ResponseWriter, r *http.Request) {
+		writeGzipJson(w, func(w io.Writer) {
+			a := arrayify(w)
+			st.Lock()
+			defer st.Unlock()
+			for _, prof := range st.profiles {
+				a.item(prof.profileSummary)
+			}
+			a.done()
+		})
+	})
+	mux.HandleFunc("GET /api/profile/{profileId}", func(w http.ResponseWriter, r *http.Request) {
+		profileIdStr := r.PathValue("profileId")
+		profileId, err := strconv.Atoi(profileIdStr)
+		if err != nil || profileId < 0 {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		defer st.Unlock()
+		i, ok := st.profileIndex(profileId)
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			prof := st.profiles[i]
+			m.pair("profile", prof)
+			a := m.array("samples")
+			for _, s := range prof.samples {
+				a.item(s)
+			}
+			a.done()
+			m.pair("scope", st.scopes[prof.scope])
+			m.pair("resource", st.resources[prof.res])
+			m.pair("request", st.requests[prof.req])
+		})
+	})
+
+	mux.HandleFunc("GET /api/calls", func(w http.ResponseWriter, r *http.Request) {
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			st.Lock()
+			defer st.Unlock()
+
+			requests := map[reqId]struct{}{}
+			a := m.array("calls")
+			for _, call := range st.calls {
+				a.item(call)
+				requests[call.req] = struct{}{}
+			}
+			a.done()
+
+			m2 := m.submap("requests")
+			for reqId := range requests {
+				m2.pair(hashToString(uint64(reqId)), st.requests[reqId])
+			}
+			m2.done()
+
+			m.done()
+		})
+	})
+	getCall := func(w http.ResponseWriter, r *http.Request) (exportCall, bool) {
+		callIdStr := r.PathValue("callId")
+		callId, err := strconv.Atoi(callIdStr)
+		if err != nil || callId < 0 {
+			writeError(w, http.StatusBadRequest)
+			return exportCall{}, false
+		}
+		st.Lock()
+		defer st.Unlock()
+		i, ok := st.callIndex(callId)
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return exportCall{}, false
+		}
+		return st.calls[i], true
+	}
+	mux.HandleFunc("GET /api/call/{callId}", func(w http.ResponseWriter, r *http.Request) {
+		call, ok := getCall(w, r)
+		if !ok {
+			return
+		}
+		st.Lock()
+		defer st.Unlock()
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			m.pair("call", call)
+			m.pair("request", st.requests[call.req])
+			m2 := m.submap("resources")
+			for rid := range call.items {
+				m2.pair(hashToString(uint64(rid)), st.resources[rid])
+			}
+			m2.done()
+		})
+	})
+	mux.HandleFunc("GET /api/call/{callId}/body", func(w http.ResponseWriter, r *http.Request) {
+		call, ok := getCall(w, r)
+		if !ok {
+			return
+		}
+		if call.body == nil {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", "application/octet-stream")
+		w.Write(call.body)
+	})
+	mux.HandleFunc("GET /api/call/{callId}/json", func(w http.ResponseWriter, r *http.Request) {
+		call, ok := getCall(w, r)
+		if !ok {
+			return
+		}
+		if call.body == nil {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		body, err := payloadToJson(call.signal, call.payload)
+		if err != nil {
+			writeError(w, http.StatusUnprocessableEntity)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(body)
+	})
+
+	mux.HandleFunc("GET /api/rejections", func(w http.ResponseWriter, r *http.Request) {
+		writeGzipJson(w, func(w io.Writer) {
+			a := arrayify(w)
+			st.Lock()
+			defer st.Unlock()
+			for _, rej := range st.rejections {
+				a.item(rej)
+			}
+			a.done()
+		})
+	})
+
+	mux.HandleFunc("GET /api/clients", func(w http.ResponseWriter, r *http.Request) {
+		writeGzipJson(w, func(w io.Writer) {
+			a := arrayify(w)
+			st.Lock()
+			defer st.Unlock()
+			for _, c := range st.clientInventory() {
+				a.item(c)
+			}
+			a.done()
+		})
+	})
+
+	mux.HandleFunc("GET /api/stats", func(w http.ResponseWriter, r *http.Request) {
+		window := 10
+		if windowStr := r.URL.Query().Get("window"); windowStr != "" {
+			var err error
+			window, err = strconv.Atoi(windowStr)
+			if err != nil || window <= 0 || window > statsWindow {
+				writeError(w, http.StatusBadRequest)
+				return
+			}
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			st.Lock()
+			defer st.Unlock()
+			report := st.stats.report(time.Now(), window)
+			report.sampling = st.sampler.report()
+			report.toJson(w)
+		})
+	})
+
+	mux.HandleFunc("POST /api/reset", func(w http.ResponseWriter, r *http.Request) {
+		st.reset()
+	})
+
+	mux.HandleFunc("GET /api/pins", func(w http.ResponseWriter, r *http.Request) {
+		writeGzipJson(w, func(w io.Writer) {
+			a := arrayify(w)
+			st.Lock()
+			defer st.Unlock()
+			st.pinList(&a)
+			a.done()
+		})
+	})
+	mux.HandleFunc("PUT /api/pin/{kind}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Note string `json:"note"`
+		}
+		if r.ContentLength != 0 {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		st.Lock()
+		defer st.Unlock()
+		key, ok := st.pinTarget(r.PathValue("kind"), r.PathValue("id"))
+		if !ok {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		st.setPin(key, body.Note)
+	})
+	mux.HandleFunc("DELETE /api/pin/{kind}/{id}", func(w http.ResponseWriter, r *http.Request) {
+		st.Lock()
+		defer st.Unlock()
+		key, ok := st.pinTarget(r.PathValue("kind"), r.PathValue("id"))
+		if !ok || !st.isPinned(key) {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		delete(st.pins, key)
+	})
+
+	writeDeletion := func(w http.ResponseWriter, d deletion, found bool) {
+		if !found {
+			writeError(w, http.StatusNotFound)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			d.toJson(&m)
+		})
+	}
+	// Deleting a single pinned item is refused, instead of silently keeping it
+	writeItemDeletion := func(w http.ResponseWriter, d deletion, found bool) {
+		if found && d.pinned > 0 {
+			http.Error(w, "pinned, unpin it first", http.StatusConflict)
+			return
+		}
+		writeDeletion(w, d, found)
+	}
+	mux.HandleFunc("DELETE /api/trace/{traceId}", func(w http.ResponseWriter, r *http.Request) {
+		tid, ok := parseTraceId(r.PathValue("traceId"))
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		d, found := st.deleteTrace(tid)
+		st.Unlock()
+		writeItemDeletion(w, d, found)
+	})
+	mux.HandleFunc("DELETE /api/log/{logId}", func(w http.ResponseWriter, r *http.Request) {
+		logId, err := strconv.Atoi(r.PathValue("logId"))
+		if err != nil || logId < 0 {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		d, found := st.deleteLog(logId)
+		st.Unlock()
+		writeItemDeletion(w, d, found)
+	})
+	mux.HandleFunc("DELETE /api/logs", func(w http.ResponseWriter, r *http.Request) {
+		f, err := parseItemFilter(r.URL.Query())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		d := st.deleteLogs(f)
+		st.Unlock()
+		writeDeletion(w, d, true)
+	})
+	mux.HandleFunc("DELETE /api/metric/{metricId}", func(w http.ResponseWriter, r *http.Request) {
+		mid, ok := parseHashId(r.PathValue("metricId"))
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		d, found := st.deleteMetric(hashId(mid))
+		st.Unlock()
+		writeItemDeletion(w, d, found)
+	})
+	mux.HandleFunc("DELETE /api/resource/{resId}", func(w http.ResponseWriter, r *http.Request) {
+		rid, ok := parseHashId(r.PathValue("resId"))
+		if !ok {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		st.Lock()
+		_, found := st.resources[resId(rid)]
+		d := st.deleteResources(func(id resId, _ resource) bool { return id == resId(rid) })
+		st.Unlock()
+		writeDeletion(w, d, found)
+	})
+	mux.HandleFunc("DELETE /api/service/{service}", func(w http.ResponseWriter, r *http.Request) {
+		service := r.PathValue("service")
+		st.Lock()
+		found := false
+		d := st.deleteResources(func(_ resId, res resource) bool {
+			name, ok := res.attr.get("service.name")
+			if ok && attrString(name) == service {
+				found = true
+				return true
+			}
+			return false
+		})
+		st.Unlock()
+		writeDeletion(w, d, found)
+	})
+
+	mux.HandleFunc("GET /api/generate", func(w http.ResponseWriter, r *http.Request) {
+		running, rate := gen.running()
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			m.pair("running", boolValue(running))
+			m.pair("rate", doubleValue(rate))
+			m.pair("tenant", stringValue(gen.tenant()))
+		})
+	})
+	mux.HandleFunc("POST /api/generate", func(w http.ResponseWriter, r *http.Request) {
+		rate := -1.0
+		if rateStr := r.URL.Query().Get("rate"); rateStr != "" {
+			var err error
+			rate, err = strconv.ParseFloat(rateStr, 64)
+			if err != nil || rate < 0 {
+				writeError(w, http.StatusBadRequest)
+				return
+			}
+		}
+		running := r.URL.Query().Get("running")
+		if running != "true" && running != "false" && running != "" {
+			writeError(w, http.StatusBadRequest)
+			return
+		}
+		if rate >= 0 {
+			gen.setRate(rate)
+		}
+		switch running {
+		case "true":
+			gen.setStorage(st)
+			gen.startGenerating()
+		case "false":
+			gen.stop()
+		}
+	})
+
+	mux.HandleFunc("POST /api/replay", func(w http.ResponseWriter, r *http.Request) {
+		var rr replayRequest
+		if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		res, err := st.replay(r.Context(), rr)
+		if err != nil {
+			status := http.StatusBadGateway
+			var re requestError
+			if errors.As(err, &re) {
+				status = re.status
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			res.toJson(&m)
+		})
+	})
+
+	return mux
+}
+
+func serveUi(st *storage, gen *generator, host string, port int) (drainFunc, int, error) {
+	var mutex sync.Mutex
+	muxes := map[*storage]*http.ServeMux{}
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/tenants", func(w http.ResponseWriter, r *http.Request) {
+		writeGzipJson(w, func(w io.Writer) {
+			m := mapify(w)
+			defer m.done()
+			if st.tenants == nil {
+				return
+			}
+			m.pair("header", stringValue(st.tenants.header))
+			a := m.array("tenants")
+			for _, name := range st.tenants.names() {
+				a.item(stringValue(name))
+			}
+			a.done()
+		})
+	})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		t, ok := st.uiTenant(w, r)
+		if !ok {
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				http.Error(w, "unknown tenant", http.StatusNotFound)
+				return
+			}
+			t = st
+		}
+		mutex.Lock()
+		tmux, ok := muxes[t]
+		if !ok {
+			tmux = uiMux(t, gen)
+			muxes[t] = tmux
+		}
+		mutex.Unlock()
+		tmux.ServeHTTP(w, r)
+	})
+
+	handler := st.self.instrumentHttp(mux, func(r *http.Request, status int, size int, start time.Time, end time.Time) {
+		route := r.Pattern
+		if route == "" {
+			route = r.Method + " " + r.URL.Path
+		}
+		st.self.recordUi(route, status, start, end)
+	})
+
+	server := http.Server{Handler: withHealth(st, handler)}
+	port, err := listenAndServe(st, &server, "UI", host, port)
+	if err != nil {
+		return nil, 0, err
+	}
+	return func(ctx context.Context) {
+		if server.Shutdown(ctx) != nil {
+			server.Close()
+		}
+	}, port, nil
+}
@@ -0,0 +1,139 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/pmetric/pmetricotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+// Stops a server, letting in-flight requests finish until ctx expires
+type drainFunc func(ctx context.Context)
+
+func (d drainFunc) stop() {
+	if d != nil {
+		d(context.Background())
+	}
+}
+
+// Waits for graceful to return, or calls force if ctx expires first
+func drainWithin(ctx context.Context, graceful func(), force func()) {
+	done := make(chan struct{})
+	go func() {
+		graceful()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-ctx.Done():
+		force()
+		<-done
+	}
+}
+
+const tenantAttr = "telui.tenant"
+
+// Adds the tenant as a resource attribute, for outputs without headers
+func setTenantAttr(req exportRequest, tenant string) {
+	switch req := req.(type) {
+	case *ptraceotlp.ExportRequest:
+		for i := range req.Traces().ResourceSpans().Len() {
+			req.Traces().ResourceSpans().At(i).Resource().Attributes().PutStr(tenantAttr, tenant)
+		}
+	case *plogotlp.ExportRequest:
+		for i := range req.Logs().ResourceLogs().Len() {
+			req.Logs().ResourceLogs().At(i).Resource().Attributes().PutStr(tenantAttr, tenant)
+		}
+	case *pmetricotlp.ExportRequest:
+		for i := range req.Metrics().ResourceMetrics().Len() {
+			req.Metrics().ResourceMetrics().At(i).Resource().Attributes().PutStr(tenantAttr, tenant)
+		}
+	}
+}
+
+// Profiles cannot be replayed, so are left out of the final export
+func reportSkippedProfiles(st *storage) {
+	n := 0
+	for _, t := range st.allTenants() {
+		t.Lock()
+		n += len(t.profiles)
+		t.Unlock()
+	}
+	if n > 0 {
+		fmt.Fprintf(st.messages, "Skipped %d profiles, which cannot be exported\n", n)
+	}
+}
+
+// Writes everything in storage, for all tenants, to an OTLP endpoint, or to a
+// file as OTLP/JSON export requests, one per line (the format of the
+// collector's file exporter). Each tenant is sent with its tenant header, or
+// written with a telui.tenant resource attribute. Profiles are skipped.
+func finalExport(st *storage, target string, timeout time.Duration) error {
+	defer reportSkippedProfiles(st)
+	if strings.Contains(target, "://") {
+		ctx, cancel := context.WithTimeout(context.Background(), timeout)
+		defer cancel()
+		var spans, logs, points int
+		for _, t := range st.allTenants() {
+			rr := replayRequest{Target: target, Compression: "gzip", All: true}
+			if t.tenant != "" {
+				rr.Headers = map[string]string{st.tenants.header: t.tenant}
+			}
+			res, err := t.replay(ctx, rr)
+			if err != nil {
+				return err
+			}
+			spans, logs, points = spans+res.spans, logs+res.logs, points+res.points
+		}
+		fmt.Fprintf(st.messages, "Exported %d spans, %d logs and %d metric points to %s\n", spans, logs, points, target)
+		return nil
+	}
+
+	var reqs []exportRequest
+	for _, t := range st.allTenants() {
+		treqs, err := t.replayRequests(replayRequest{All: true})
+		if err != nil {
+			return err
+		}
+		if t.tenant != "" {
+			for _, req := range treqs {
+				setTenantAttr(req, t.tenant)
+			}
+		}
+		reqs = append(reqs, treqs...)
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+	var spans, logs, points int
+	for _, req := range reqs {
+		b, err := req.MarshalJSON()
+		if err != nil {
+			return err
+		}
+		w.Write(b)
+		w.WriteByte('\n')
+		switch req := req.(type) {
+		case *ptraceotlp.ExportRequest:
+			spans += req.Traces().SpanCount()
+		case *plogotlp.ExportRequest:
+			logs += req.Logs().LogRecordCount()
+		case *pmetricotlp.ExportRequest:
+			points += req.Metrics().DataPointCount()
+		}
+	}
+	if err := w.Flush(); err != nil {
+		return err
+	}
+	fmt.Fprintf(st.messages, "Exported %d spans, %d logs and %d metric points to %s\n", spans, logs, points, target)
+	return nil
+}
@@ -0,0 +1,350 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+type rawJson string
+
+func (rj rawJson) hashInto(h hash.Hash64) {
+	forceWriteString(h, string(rj))
+}
+func (rj rawJson) toJson(w io.Writer) {
+	forceWriteString(w, string(rj))
+}
+
+func sortedJson(items []string) arrayValue {
+	slices.Sort(items)
+	var a arrayValue
+	for _, item := range items {
+		a.add(rawJson(item))
+	}
+	return a
+}
+
+type snapshotter struct {
+	st      *storage
+	ignore  map[string]bool // attributes which change on every run, eg. process.pid
+	resIdx  map[resId]int
+	scopeIx map[scopeId]int
+}
+
+func (sn *snapshotter) attr(m mapValue) mapValue {
+	var m2 mapValue
+	for _, p := range m.Pairs {
+		if !sn.ignore[p.K] {
+			m2.add(p.K, p.V)
+		}
+	}
+	return m2
+}
+
+func (sn *snapshotter) putAttr(m *mapifier, attr mapValue) {
+	if attr = sn.attr(attr); attr.notEmpty() {
+		m.pair("attr", attr)
+	}
+}
+
+func (sn *snapshotter) resources() arrayValue {
+	var items []string
+	byJson := map[string][]resId{}
+	for rid, res := range sn.st.resources {
+		res.attr = sn.attr(res.attr)
+		j := jsonToString(res)
+		if _, ok := byJson[j]; !ok {
+			items = append(items, j)
+		}
+		byJson[j] = append(byJson[j], rid)
+	}
+	a := sortedJson(items)
+	for i, item := range a.Items {
+		for _, rid := range byJson[string(item.(rawJson))] {
+			sn.resIdx[rid] = i
+		}
+	}
+	return a
+}
+
+func (sn *snapshotter) scopes() arrayValue {
+	var items []string
+	byJson := map[string][]scopeId{}
+	for sid, sc := range sn.st.scopes {
+		sc.attr = sn.attr(sc.attr)
+		j := jsonToString(sc)
+		if _, ok := byJson[j]; !ok {
+			items = append(items, j)
+		}
+		byJson[j] = append(byJson[j], sid)
+	}
+	a := sortedJson(items)
+	for i, item := range a.Items {
+		for _, sid := range byJson[string(item.(rawJson))] {
+			sn.scopeIx[sid] = i
+		}
+	}
+	return a
+}
+
+// Spans are nested under their parent, so the trace structure survives without the IDs
+func (sn *snapshotter) span(tr *trace, children map[spanId][]spanId, sid spanId) string {
+	sp := tr.spans[sid]
+	var b strings.Builder
+	m := mapify(&b)
+	m.pair("res", intValue(sn.resIdx[sp.res]))
+	m.pair("scope", intValue(sn.scopeIx[sp.scope]))
+	m.pair("name", stringValue(sp.name))
+	m.pair("kind", stringValue(sp.kind))
+	if sp.status != "" {
+		m.pair("status", stringValue(sp.status))
+	}
+	if sp.statusMsg != "" {
+		m.pair("status.msg", stringValue(sp.statusMsg))
+	}
+	sn.putAttr(&m, sp.attr)
+	if len(sp.events) > 0 {
+		a := m.array("events")
+		for _, e := range sp.events {
+			m2 := a.submap()
+			m2.pair("name", stringValue(e.name))
+			sn.putAttr(&m2, e.attr)
+			m2.done()
+		}
+		a.done()
+	}
+	if len(sp.links) > 0 {
+		a := m.array("links")
+		for _, l := range sp.links {
+			m2 := a.submap()
+			sn.putAttr(&m2, l.attr)
+			m2.done()
+		}
+		a.done()
+	}
+	if len(children[sid]) > 0 {
+		var items []string
+		for _, child := range children[sid] {
+			items = append(items, sn.span(tr, children, child))
+		}
+		m.pair("children", sortedJson(items))
+	}
+	m.done()
+	return b.String()
+}
+
+func (sn *snapshotter) traces() arrayValue {
+	var items []string
+	for _, tr := range sn.st.traces {
+		roots, children := tr.tree()
+		var spans []string
+		for _, sid := range roots {
+			spans = append(spans, sn.span(tr, children, sid))
+		}
+		items = append(items, jsonToString(sortedJson(spans)))
+	}
+	return sortedJson(items)
+}
+
+func (sn *snapshotter) logs() arrayValue {
+	var items []string
+	for _, l := range sn.st.logs {
+		var b strings.Builder
+		m := mapify(&b)
+		m.pair("res", intValue(sn.resIdx[l.res]))
+		m.pair("scope", intValue(sn.scopeIx[l.scope]))
+		if l.sev != "" {
+			m.pair("sev", stringValue(l.sev))
+		}
+		if l.sevText != "" {
+			m.pair("sev.text", stringValue(l.sevText))
+		}
+		if l.event != "" {
+			m.pair("event", stringValue(l.event))
+		}
+		if l.body != nil {
+			m.pair("body", l.body)
+		}
+		sn.putAttr(&m, l.attr)
+		if l.span.notEmpty() {
+			m.pair("in.span", boolValue(true))
+		}
+		m.done()
+		items = append(items, b.String())
+	}
+	return sortedJson(items)
+}
+
+// Point values depend on timing, so only the streams' attributes are kept
+func (sn *snapshotter) metrics() arrayValue {
+	var items []string
+	for _, me := range sn.st.metrics {
+		var b strings.Builder
+		m := mapify(&b)
+		mi := me.metricIdentity
+		m.pair("res", intValue(sn.resIdx[mi.res]))
+		m.pair("scope", intValue(sn.scopeIx[mi.scope]))
+		m.pair("name", stringValue(mi.name))
+		m.pair("type", stringValue(mi.type_))
+		if mi.unit != "" {
+			m.pair("unit", stringValue(mi.unit))
+		}
+		if mi.tempo != "" {
+			m.pair("tempo", stringValue(mi.tempo))
+		}
+		if mi.type_ == "Sum" {
+			m.pair("mono", boolValue(mi.mono))
+		}
+		if me.desc != "" {
+			m.pair("desc", stringValue(me.desc))
+		}
+		var streams []string
+		for _, ms := range me.streams {
+			streams = append(streams, jsonToString(sn.attr(ms.attr)))
+		}
+		slices.Sort(streams)
+		m.pair("streams", sortedJson(slices.Compact(streams)))
+		m.done()
+		items = append(items, b.String())
+	}
+	return sortedJson(items)
+}
+
+// Returns the stored telemetry as indented JSON, without timestamps, IDs or
+// request metadata, and in a deterministic order
+func (st *storage) snapshot(ignoreAttrs []string) []byte {
+	sn := &snapshotter{
+		st:      st,
+		ignore:  map[string]bool{},
+		resIdx:  map[resId]int{},
+		scopeIx: map[scopeId]int{},
+	}
+	for _, k := range ignoreAttrs {
+		sn.ignore[k] = true
+	}
+
+	st.Lock()
+	var b bytes.Buffer
+	m := mapify(&b)
+	m.pair("resources", sn.resources())
+	m.pair("scopes", sn.scopes())
+	m.pair("traces", sn.traces())
+	m.pair("logs", sn.logs())
+	m.pair("metrics", sn.metrics())
+	m.done()
+	st.Unlock()
+
+	var out bytes.Buffer
+	if err := json.Indent(&out, b.Bytes(), "", "  "); err != nil {
+		panic("invalid snapshot JSON")
+	}
+	out.WriteByte('\n')
+	return out.Bytes()
+}
+
+// Snapshot returns the received telemetry in a normalized form suitable for
+// golden files: timestamps, IDs, request metadata and metric values are
+// stripped, and items are sorted. Attributes with the given keys are dropped.
+func (r *Receiver) Snapshot(ignoreAttrs ...string) []byte {
+	return r.st.snapshot(ignoreAttrs)
+}
+
+// CompareGolden compares the snapshot with the contents of a golden file, and
+// returns a line diff if they differ. With update, the golden file is
+// (re)written instead.
+func (r *Receiver) CompareGolden(path string, update bool, ignoreAttrs ...string) error {
+	return compareGolden(r.Snapshot(ignoreAttrs...), path, update)
+}
+
+func compareGolden(snapshot []byte, path string, update bool) error {
+	if update {
+		return os.WriteFile(path, snapshot, 0o644)
+	}
+	golden, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(golden, snapshot) {
+		return nil
+	}
+	return fmt.Errorf("telemetry differs from golden file %s:\n%s", path, lineDiff(string(golden), string(snapshot)))
+}
+
+const maxDiffCells = 16_000_000
+
+// Shows removed lines with "-" and added lines with "+", with some context
+func lineDiff(a string, b string) string {
+	as := strings.Split(a, "\n")
+	bs := strings.Split(b, "\n")
+	if len(as)*len(bs) > maxDiffCells {
+		for i := range min(len(as), len(bs)) {
+			if as[i] != bs[i] {
+				return fmt.Sprintf("first difference at line %d:\n-%s\n+%s\n", i+1, as[i], bs[i])
+			}
+		}
+		return "files differ in length\n"
+	}
+
+	// Longest common subsequence of lines
+	lcs := make([][]int32, len(as)+1)
+	for i := range lcs {
+		lcs[i] = make([]int32, len(bs)+1)
+	}
+	for i := len(as) - 1; i >= 0; i-- {
+		for j := len(bs) - 1; j >= 0; j-- {
+			if as[i] == bs[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	type diffLine struct {
+		op   byte
+		text string
+	}
+	var lines []diffLine
+	i, j := 0, 0
+	for i < len(as) || j < len(bs) {
+		switch {
+		case i < len(as) && j < len(bs) && as[i] == bs[j]:
+			lines = append(lines, diffLine{' ', as[i]})
+			i++
+			j++
+		case j < len(bs) && (i == len(as) || lcs[i][j+1] >= lcs[i+1][j]):
+			lines = append(lines, diffLine{'+', bs[j]})
+			j++
+		default:
+			lines = append(lines, diffLine{'-', as[i]})
+			i++
+		}
+	}
+
+	const context = 3
+	var out strings.Builder
+	lastShown := -1
+	for k, l := range lines {
+		show := false
+		for d := max(0, k-context); d <= min(len(lines)-1, k+context); d++ {
+			if lines[d].op != ' ' {
+				show = true
+				break
+			}
+		}
+		if !show {
+			continue
+		}
+		if lastShown != -1 && k > lastShown+1 {
+			out.WriteString("...\n")
+		}
+		fmt.Fprintf(&out, "%c%s\n", l.op, l.text)
+		lastShown = k
+	}
+	return out.String()
+}
@@ -0,0 +1,165 @@
+package server
+
+import (
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+)
+
+const statsWindow = 300 // seconds of history kept for rates
+
+type statsGroup struct {
+	kind string // "signal", "service" or "client"
+	name string
+}
+
+type statsCounters struct {
+	requests int
+	bytes    int
+	items    map[string]int
+}
+
+func (sc *statsCounters) add(signal string, items int, bytes int) {
+	if sc.items == nil {
+		sc.items = map[string]int{}
+	}
+	sc.requests++
+	sc.bytes += bytes
+	sc.items[signal] += items
+}
+
+func (sc *statsCounters) merge(sc2 statsCounters) {
+	if sc.items == nil {
+		sc.items = map[string]int{}
+	}
+	sc.requests += sc2.requests
+	sc.bytes += sc2.bytes
+	for signal, n := range sc2.items {
+		sc.items[signal] += n
+	}
+}
+
+func (sc statsCounters) toJson(m *mapifier) {
+	m.pair("requests", intValue(sc.requests))
+	m.pair("bytes", intValue(sc.bytes))
+	m2 := m.submap("items")
+	for _, signal := range slices.Sorted(maps.Keys(sc.items)) {
+		m2.pair(signal, intValue(sc.items[signal]))
+	}
+	m2.done()
+}
+
+type statsBucket struct {
+	second int64
+	groups map[statsGroup]*statsCounters
+}
+
+type statsTotal struct {
+	statsCounters
+	first timestampValue
+	last  timestampValue
+}
+
+type ingestStats struct {
+	buckets [statsWindow]statsBucket
+	totals  map[statsGroup]*statsTotal
+}
+
+func newIngestStats() *ingestStats {
+	return &ingestStats{totals: map[statsGroup]*statsTotal{}}
+}
+
+func (is *ingestStats) record(now time.Time, group statsGroup, signal string, items int, bytes int) {
+	sec := now.Unix()
+	b := &is.buckets[sec%statsWindow]
+	if b.second != sec || b.groups == nil {
+		b.second = sec
+		b.groups = map[statsGroup]*statsCounters{}
+	}
+	sc, ok := b.groups[group]
+	if !ok {
+		sc = &statsCounters{}
+		b.groups[group] = sc
+	}
+	sc.add(signal, items, bytes)
+
+	t, ok := is.totals[group]
+	if !ok {
+		t = &statsTotal{first: timestampValue(now.UnixNano())}
+		is.totals[group] = t
+	}
+	t.add(signal, items, bytes)
+	t.last = timestampValue(now.UnixNano())
+}
+
+// Sums the counters of each group over the last `window` seconds
+func (is *ingestStats) recent(now time.Time, window int) map[statsGroup]statsCounters {
+	recent := map[statsGroup]statsCounters{}
+	sec := now.Unix()
+	for i := range min(window, statsWindow) {
+		b := is.buckets[(sec-int64(i))%statsWindow]
+		if b.second != sec-int64(i) {
+			continue
+		}
+		for group, sc := range b.groups {
+			sc2 := recent[group]
+			sc2.merge(*sc)
+			recent[group] = sc2
+		}
+	}
+	return recent
+}
+
+type statsReport struct {
+	window   int
+	recent   map[statsGroup]statsCounters
+	totals   map[statsGroup]*statsTotal
+	sampling *samplingReport // nil if sampling is off
+}
+
+func (is *ingestStats) report(now time.Time, window int) statsReport {
+	return statsReport{
+		window: window,
+		recent: is.recent(now, window),
+		totals: is.totals,
+	}
+}
+
+func (sr statsReport) toJson(w io.Writer) {
+	m := mapify(w)
+	defer m.done()
+	m.pair("window", intValue(sr.window))
+	for _, kind := range []string{"signal", "service", "client"} {
+		m2 := m.submap(kind + "s")
+		var groups []statsGroup
+		for group := range sr.totals {
+			if group.kind == kind {
+				groups = append(groups, group)
+			}
+		}
+		slices.SortFunc(groups, func(g1 statsGroup, g2 statsGroup) int {
+			return strings.Compare(g1.name, g2.name)
+		})
+		for _, group := range groups {
+			t := sr.totals[group]
+			m3 := m2.submap(group.name)
+			m4 := m3.submap("recent")
+			sr.recent[group].toJson(&m4)
+			m4.done()
+			m4 = m3.submap("total")
+			t.statsCounters.toJson(&m4)
+			m4.done()
+			m3.pair("first", t.first)
+			m3.pair("last", t.last)
+			m3.done()
+		}
+		m2.done()
+	}
+	if sr.sampling != nil {
+		m2 := m.submap("sampling")
+		sr.sampling.toJson(&m2)
+		m2.done()
+	}
+}
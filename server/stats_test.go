@@ -0,0 +1,41 @@
+package server
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIngestStatsWindow(t *testing.T) {
+	is := newIngestStats()
+	now := time.Unix(1_000_000, 0)
+	logs := statsGroup{"signal", "logs"}
+	is.record(now.Add(-statsWindow*time.Second), logs, "logs", 100, 1000) // same bucket as now
+	is.record(now.Add(-90*time.Second), logs, "logs", 10, 100)
+	is.record(now.Add(-30*time.Second), logs, "logs", 3, 30)
+	is.record(now, logs, "logs", 1, 10)
+
+	tests := []struct {
+		window   int
+		requests int
+		items    int
+	}{
+		{1, 1, 1},
+		{60, 2, 4},
+		{120, 3, 14},
+		{2 * statsWindow, 3, 14},
+	}
+	for _, tt := range tests {
+		sc := is.recent(now, tt.window)[logs]
+		if sc.requests != tt.requests || sc.items["logs"] != tt.items {
+			t.Errorf("over %ds: %d requests and %d items, want %d and %d",
+				tt.window, sc.requests, sc.items["logs"], tt.requests, tt.items)
+		}
+	}
+	total := is.totals[logs]
+	if total.requests != 4 || total.bytes != 1140 {
+		t.Errorf("total: %d requests and %d bytes, want 4 and 1140", total.requests, total.bytes)
+	}
+	if total.first != timestampValue(now.Add(-statsWindow*time.Second).UnixNano()) || total.last != timestampValue(now.UnixNano()) {
+		t.Errorf("total from %v to %v, want the first and last requests", total.first, total.last)
+	}
+}
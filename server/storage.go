@@ -0,0 +1,1081 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"unicode/utf8"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/pmetric"
+	"go.opentelemetry.io/collector/pdata/pprofile"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+// Settings and outputs shared by all tenants, so that changes reach them
+type sharedSettings struct {
+	verbose  atomic.Bool // can be changed by reloading the config
+	capture  atomic.Bool
+	messages io.Writer // status messages
+	self     *selfTelemetry
+	forward  *forwarder
+	ndjson   *ndjsonWriter
+	redact   *redactor
+	sampler  *sampler
+}
+
+type storage struct {
+	sync.Mutex
+	*sharedSettings
+	ready      atomic.Bool  // all endpoints are started, and telui is not stopping
+	readyFuncs []func(bool) // called by setReady, registered before serving
+	tenants    *tenantSet   // nil unless partitioning by tenant
+	tenant     string       // "" for the default tenant
+	requests   map[reqId]requestMeta
+	calls      []exportCall
+	nextCall   int
+	rejections []rejection
+	stats      *ingestStats
+	resources  map[resId]resource
+	scopes     map[scopeId]scope
+	traces     map[traceId]*trace
+	logs       []log
+	nextLog    int
+	traceLogs  map[traceId][]int // log IDs
+	receiving  int               // requests being received
+	gcPending  bool              // garbage collection waits for receiving to be 0
+	metrics    map[hashId]*metric
+	profiles   []profile
+	nextProf   int
+	pins       map[pinKey]pin
+}
+
+func newStorage(verbose bool, capture bool) *storage {
+	st := &storage{sharedSettings: &sharedSettings{messages: os.Stdout}}
+	st.verbose.Store(verbose)
+	st.capture.Store(capture)
+	st.reset()
+	return st
+}
+
+func (st *storage) Lock() {
+	if st.self == nil {
+		st.Mutex.Lock()
+		return
+	}
+	start := time.Now()
+	st.Mutex.Lock()
+	st.self.recordLockWait(time.Since(start))
+}
+
+// Forgets everything except pinned items
+func (st *storage) reset() {
+	st.Lock()
+	defer st.Unlock()
+	if st.pins == nil {
+		st.pins = map[pinKey]pin{}
+	}
+	traces, logs, metrics := st.traces, st.logs, st.metrics
+	st.calls = nil
+	st.rejections = nil
+	st.stats = newIngestStats()
+	st.traces = map[traceId]*trace{}
+	st.logs = nil
+	st.metrics = map[hashId]*metric{}
+	st.profiles = nil
+	for tid, tr := range traces {
+		if st.isPinned(tracePin(tid)) {
+			st.traces[tid] = tr
+		}
+	}
+	for _, l := range logs {
+		if st.isPinned(logPin(l.id)) {
+			st.logs = append(st.logs, l)
+		}
+	}
+	st.reindexLogs()
+	for mid, m := range metrics {
+		if st.isPinned(metricPin(mid)) {
+			st.metrics[mid] = m
+		}
+	}
+	if st.requests == nil {
+		st.requests = map[reqId]requestMeta{}
+		st.resources = map[resId]resource{}
+		st.scopes = map[scopeId]scope{}
+	} else {
+		st.collectGarbage()
+	}
+	st.sampler.reset(st)
+}
+
+// Converts attributes, applying the redaction rules
+func (st *storage) convertAttr(m pcommon.Map) mapValue {
+	return st.redact.attrs(convertMap(m))
+}
+
+func (st *storage) receiveRequestMeta(req requestMeta) reqId {
+	req = st.redact.request(req)
+	reqId := reqId(hashValue(req))
+	st.Lock()
+	st.receiving++
+	if _, ok := st.requests[reqId]; !ok {
+		st.requests[reqId] = req
+	}
+	st.Unlock()
+
+	if st.verbose.Load() {
+		fmt.Printf("req: %s\n", jsonToString(req))
+	}
+
+	return reqId
+}
+
+func (st *storage) receiveCall(signal string, reqId reqId, pl payload, items map[resId]int) {
+	st.ndjson.flush()
+	if !st.capture.Load() {
+		pl.body = nil
+	}
+	pl = st.redact.payload(signal, pl)
+	now := time.Now()
+	call := exportCall{
+		payload: pl,
+		req:     reqId,
+		signal:  signal,
+		time:    timestampValue(now.UnixNano()),
+		items:   items,
+	}
+	st.Lock()
+	call.id = st.nextCall
+	st.nextCall++
+	st.calls = append(st.calls, call)
+	st.receiving--
+	if st.gcPending {
+		st.collectGarbage()
+	}
+	req := st.requests[reqId]
+	client := req.peerHost()
+	if ua := req.header("User-Agent"); ua != "" {
+		client += " " + ua
+	}
+	st.stats.record(now, statsGroup{"signal", signal}, signal, call.itemCount(), pl.wireSize)
+	st.stats.record(now, statsGroup{"client", client}, signal, call.itemCount(), pl.wireSize)
+	// Split the size between services by number of items, so that they add up
+	// to the total
+	services := map[string]int{}
+	for rid, n := range items {
+		services[st.serviceName(rid)] += n
+	}
+	bytes := pl.wireSize
+	total := call.itemCount()
+	for i, service := range slices.Sorted(maps.Keys(services)) {
+		n := services[service]
+		share := bytes
+		if i < len(services)-1 {
+			if total == 0 {
+				share = pl.wireSize / len(services)
+			} else {
+				share = pl.wireSize * n / total
+			}
+		}
+		bytes -= share
+		st.stats.record(now, statsGroup{"service", service}, signal, n, share)
+	}
+	st.Unlock()
+}
+
+// Finds a log by ID; must be called with the storage locked
+func (st *storage) logIndex(id int) (int, bool) {
+	return slices.BinarySearchFunc(st.logs, id, func(l log, id int) int {
+		return cmp.Compare(l.id, id)
+	})
+}
+
+// Finds a call by ID; must be called with the storage locked
+func (st *storage) callIndex(id int) (int, bool) {
+	return slices.BinarySearchFunc(st.calls, id, func(c exportCall, id int) int {
+		return cmp.Compare(c.id, id)
+	})
+}
+
+// Finds a profile by ID; must be called with the storage locked
+func (st *storage) profileIndex(num int) (int, bool) {
+	return slices.BinarySearchFunc(st.profiles, num, func(p profile, num int) int {
+		return cmp.Compare(p.num, num)
+	})
+}
+
+// Must be called with the storage locked
+func (st *storage) serviceName(res resId) string {
+	if name, ok := st.resources[res].attr.get("service.name"); ok {
+		return attrString(name)
+	}
+	return "unknown_service"
+}
+
+const maxRejections = 100
+const maxRejectedBody = 256
+
+func (st *storage) receiveRejection(signal string, req requestMeta, pl payload, status string, err error) {
+	if pl.body != nil {
+		pl.size = len(pl.body)
+	}
+	if len(pl.body) > maxRejectedBody {
+		pl.body = pl.body[:maxRejectedBody]
+	}
+	pl.body = slices.Clone(pl.body)
+	pl = st.redact.payload(signal, pl)
+	rej := rejection{
+		req:     st.redact.request(req),
+		signal:  signal,
+		time:    timestampValue(time.Now().UnixNano()),
+		status:  status,
+		err:     err.Error(),
+		payload: pl,
+	}
+	st.Lock()
+	st.rejections = append(st.rejections, rej)
+	if len(st.rejections) > maxRejections {
+		st.rejections = slices.Delete(st.rejections, 0, len(st.rejections)-maxRejections)
+	}
+	st.Unlock()
+}
+
+func (st *storage) receiveResource(r pcommon.Resource, schemaUrl string) resId {
+	res := resource{
+		attr:        st.convertAttr(r.Attributes()),
+		attrDropped: r.DroppedAttributesCount(),
+		schema:      schemaUrl,
+	}
+
+	resId := resId(hashValue(res))
+	st.Lock()
+	if res2, ok := st.resources[resId]; ok {
+		res = res2
+	} else {
+		st.resources[resId] = res
+	}
+	st.Unlock()
+
+	if st.verbose.Load() {
+		fmt.Printf("res: %s\n", jsonToString(res))
+	}
+
+	return resId
+}
+
+func (st *storage) receiveScope(sc pcommon.InstrumentationScope, schemaUrl string) scopeId {
+	scope := scope{
+		name:        sc.Name(),
+		version:     sc.Version(),
+		attr:        st.convertAttr(sc.Attributes()),
+		attrDropped: sc.DroppedAttributesCount(),
+		schema:      schemaUrl,
+	}
+
+	scopeId := scopeId(hashValue(scope))
+	st.Lock()
+	if scope2, ok := st.scopes[scopeId]; ok {
+		scope = scope2
+	} else {
+		st.scopes[scopeId] = scope
+	}
+	st.Unlock()
+
+	if st.verbose.Load() {
+		fmt.Printf("  scope: %s\n", jsonToString(scope))
+	}
+
+	return scopeId
+}
+
+func (st *storage) receiveTraces(t ptrace.Traces, req requestMeta, pl payload) {
+	reqId := st.receiveRequestMeta(req)
+	items := map[resId]int{}
+
+	rss := t.ResourceSpans()
+	for i := range rss.Len() {
+		rs := rss.At(i)
+
+		resId := st.receiveResource(rs.Resource(), rs.SchemaUrl())
+		st.Lock()
+		service := st.serviceName(resId)
+		st.Unlock()
+
+		scss := rs.ScopeSpans()
+		for j := range scss.Len() {
+			scs := scss.At(j)
+
+			scopeId := st.receiveScope(scs.Scope(), scs.SchemaUrl())
+
+			sps := scs.Spans()
+			items[resId] += sps.Len()
+			for k := range sps.Len() {
+				sp := sps.At(k)
+
+				tid := traceId(sp.TraceID())
+				sid := spanId(sp.SpanID())
+				sp2 := span{
+					spanSummary: spanSummary{
+						parent: spanId(sp.ParentSpanID()),
+						name:   sp.Name(),
+						start:  timestampValue(sp.StartTimestamp()),
+						end:    timestampValue(sp.EndTimestamp()),
+					},
+					req:           reqId,
+					res:           resId,
+					scope:         scopeId,
+					statusMsg:     sp.Status().Message(),
+					kind:          sp.Kind().String(),
+					attr:          st.convertAttr(sp.Attributes()),
+					attrDropped:   sp.DroppedAttributesCount(),
+					state:         sp.TraceState().AsRaw(),
+					flags:         flagsValue(sp.Flags()),
+					eventsDropped: sp.DroppedEventsCount(),
+					linksDropped:  sp.DroppedLinksCount(),
+				}
+				if code := sp.Status().Code(); code != ptrace.StatusCodeUnset {
+					sp2.status = code.String()
+				}
+				es := sp.Events()
+				for i := range es.Len() {
+					e := es.At(i)
+					sp2.events = append(sp2.events, event{
+						name:        e.Name(),
+						time:        timestampValue(e.Timestamp()),
+						attr:        st.convertAttr(e.Attributes()),
+						attrDropped: e.DroppedAttributesCount(),
+					})
+				}
+				ls := sp.Links()
+				for i := range ls.Len() {
+					l := ls.At(i)
+					sp2.links = append(sp2.links, link{
+						trace:       traceId(l.TraceID()),
+						span:        spanId(l.SpanID()),
+						attr:        st.convertAttr(l.Attributes()),
+						attrDropped: l.DroppedAttributesCount(),
+						state:       l.TraceState().AsRaw(),
+					})
+				}
+
+				if st.sampler.admit(st, tid, sid, sp2, service) {
+					st.storeSpan(tid, sid, sp2)
+				}
+			}
+		}
+	}
+
+	st.receiveCall("traces", reqId, pl, items)
+}
+
+func (st *storage) storeSpan(tid traceId, sid spanId, sp span) {
+	st.Lock()
+	tr, ok := st.traces[tid]
+	if !ok {
+		tr = &trace{
+			spans: make(map[spanId]span),
+		}
+		st.traces[tid] = tr
+	}
+	_, dup := tr.spans[sid]
+	if dup {
+		fmt.Fprintf(os.Stderr, "Warning: span %x received twice\n", sid)
+	} else {
+		tr.spans[sid] = sp
+	}
+	st.Unlock()
+
+	if !dup {
+		st.ndjson.span(st, tid, sid, sp)
+	}
+
+	if st.verbose.Load() {
+		fmt.Printf("    span: %s\n", jsonToString(sp))
+	}
+}
+
+func (st *storage) receiveLogs(l plog.Logs, req requestMeta, pl payload) {
+	reqId := st.receiveRequestMeta(req)
+	items := map[resId]int{}
+
+	rls := l.ResourceLogs()
+	for i := range rls.Len() {
+		rl := rls.At(i)
+
+		resId := st.receiveResource(rl.Resource(), rl.SchemaUrl())
+
+		scls := rl.ScopeLogs()
+		for j := range scls.Len() {
+			scl := scls.At(j)
+
+			scopeId := st.receiveScope(scl.Scope(), scl.SchemaUrl())
+
+			lrs := scl.LogRecords()
+			items[resId] += lrs.Len()
+			for k := range lrs.Len() {
+				lr := lrs.At(k)
+
+				log := log{
+					req:         reqId,
+					res:         resId,
+					scope:       scopeId,
+					time:        timestampValue(lr.Timestamp()),
+					timeObs:     timestampValue(lr.ObservedTimestamp()),
+					sevText:     lr.SeverityText(),
+					event:       lr.EventName(),
+					attr:        st.convertAttr(lr.Attributes()),
+					attrDropped: lr.DroppedAttributesCount(),
+					flags:       flagsValue(lr.Flags()),
+					trace:       traceId(lr.TraceID()),
+					span:        spanId(lr.SpanID()),
+				}
+				if sev := lr.SeverityNumber(); sev != plog.SeverityNumberUnspecified {
+					log.sev = sev.String()
+				}
+				if body := lr.Body(); body.Type() != pcommon.ValueTypeEmpty {
+					log.body = st.redact.value(convertValue(body))
+				}
+
+				if log.event != "" {
+					log.simpleBody = log.event
+				} else if log.body != nil {
+					if logStr, ok := log.body.(stringValue); ok {
+						log.simpleBody = string(logStr)
+					} else {
+						log.simpleBody = jsonToString(log.body)
+					}
+				} else {
+					log.simpleBody = "<no body>"
+				}
+				const maxLogLength = 130
+				nlIdx := strings.IndexByte(log.simpleBody[:min(maxLogLength, len(log.simpleBody))], '\n')
+				if len(log.simpleBody) > maxLogLength || nlIdx != -1 {
+					i := maxLogLength
+					if nlIdx != -1 {
+						i = nlIdx
+					}
+					for !utf8.RuneStart(log.simpleBody[i]) {
+						i--
+					}
+					log.simpleBody = log.simpleBody[:i] + " [...]"
+				}
+
+				if log.time.notEmpty() {
+					log.simpleTime = log.time
+				} else if log.timeObs.notEmpty() {
+					log.simpleTime = log.timeObs
+				} else {
+					log.simpleTime = timestampValue(time.Now().UnixNano())
+				}
+
+				st.Lock()
+				log.id = st.nextLog
+				st.nextLog++
+				st.logs = append(st.logs, log)
+				st.indexLog(log)
+				st.Unlock()
+
+				st.ndjson.log(st, log)
+
+				if st.verbose.Load() {
+					fmt.Printf("    log: %s\n", jsonToString(log))
+				}
+			}
+		}
+	}
+
+	st.receiveCall("logs", reqId, pl, items)
+}
+
+type pointGetter interface {
+	Attributes() pcommon.Map
+	Timestamp() pcommon.Timestamp
+	StartTimestamp() pcommon.Timestamp
+	Flags() pmetric.DataPointFlags
+}
+
+var _ pointGetter = pmetric.NumberDataPoint{}
+var _ pointGetter = pmetric.HistogramDataPoint{}
+var _ pointGetter = pmetric.ExponentialHistogramDataPoint{}
+var _ pointGetter = pmetric.SummaryDataPoint{}
+
+type pointSlice[T pointGetter] interface {
+	At(i int) T
+	Len() int
+}
+
+func receivePoints[T pointGetter](st *storage, reqId reqId, m *metric, ps pointSlice[T], makePoint func(point, T) pointlike) {
+	for i := range ps.Len() {
+		dp := ps.At(i)
+		attr := st.convertAttr(dp.Attributes())
+		msId := hashId(hashValue(attr))
+		st.Lock()
+		ms, ok := m.streams[msId]
+		if !ok {
+			ms = &metricStream{attr: attr}
+			m.streams[msId] = ms
+		}
+		st.Unlock()
+
+		point := makePoint(point{
+			time:      timestampValue(dp.Timestamp()),
+			timeStart: timestampValue(dp.StartTimestamp()),
+			flags:     flagsValue(dp.Flags()),
+			req:       reqId,
+		}, dp)
+
+		st.Lock()
+		ms.points = append(ms.points, point)
+		st.Unlock()
+
+		st.ndjson.point(st, m, attr, point)
+	}
+}
+
+func (st *storage) convertExemplars(es pmetric.ExemplarSlice) []exemplar {
+	var exemplars []exemplar
+	if es.Len() != 0 {
+		exemplars = make([]exemplar, 0, es.Len())
+	}
+	for j := range es.Len() {
+		e := es.At(j)
+		examplar := exemplar{
+			time:  timestampValue(e.Timestamp()),
+			attr:  st.convertAttr(e.FilteredAttributes()),
+			span:  spanId(e.SpanID()),
+			trace: traceId(e.TraceID()),
+		}
+
+		switch e.ValueType() {
+		case pmetric.ExemplarValueTypeInt:
+			examplar.value = intValue(e.IntValue())
+		case pmetric.ExemplarValueTypeDouble:
+			examplar.value = doubleValue(e.DoubleValue())
+		default:
+			panic("unknown metric examplar value type")
+		}
+
+		exemplars = append(exemplars, examplar)
+	}
+	return exemplars
+}
+
+func (st *storage) receiveNumberPoints(reqId reqId, m *metric, ndps pmetric.NumberDataPointSlice) {
+	receivePoints(st, reqId, m, ndps, func(p point, ndp pmetric.NumberDataPoint) pointlike {
+		numberPoint := numberPoint{
+			point:     p,
+			exemplars: st.convertExemplars(ndp.Exemplars()),
+		}
+
+		switch ndp.ValueType() {
+		case pmetric.NumberDataPointValueTypeInt:
+			numberPoint.value = intValue(ndp.IntValue())
+		case pmetric.NumberDataPointValueTypeDouble:
+			numberPoint.value = doubleValue(ndp.DoubleValue())
+		case pmetric.NumberDataPointValueTypeEmpty:
+			numberPoint.value = nil
+		default:
+			panic("unknown metric point value type")
+		}
+
+		return numberPoint
+	})
+}
+
+type histolikePointGetter interface {
+	pointGetter
+	Count() uint64
+	HasSum() bool
+	HasMin() bool
+	HasMax() bool
+	Sum() float64
+	Min() float64
+	Max() float64
+	Exemplars() pmetric.ExemplarSlice
+}
+
+var _ histolikePointGetter = pmetric.HistogramDataPoint{}
+var _ histolikePointGetter = pmetric.ExponentialHistogramDataPoint{}
+
+func receiveHistolikePoints[T histolikePointGetter](st *storage, reqId reqId, m *metric, ps pointSlice[T], makePoint func(histolikePoint, T) pointlike) {
+	receivePoints(st, reqId, m, ps, func(p point, dp T) pointlike {
+		return makePoint(histolikePoint{
+			point: p,
+			count: dp.Count(),
+			has: struct {
+				sum bool
+				min bool
+				max bool
+			}{
+				sum: dp.HasSum(),
+				min: dp.HasMin(),
+				max: dp.HasMax(),
+			},
+			sum:       dp.Sum(),
+			min:       dp.Min(),
+			max:       dp.Max(),
+			exemplars: st.convertExemplars(dp.Exemplars()),
+		}, dp)
+	})
+}
+
+func metricPointCount(m pmetric.Metric) int {
+	switch m.Type() {
+	case pmetric.MetricTypeGauge:
+		return m.Gauge().DataPoints().Len()
+	case pmetric.MetricTypeSum:
+		return m.Sum().DataPoints().Len()
+	case pmetric.MetricTypeHistogram:
+		return m.Histogram().DataPoints().Len()
+	case pmetric.MetricTypeExponentialHistogram:
+		return m.ExponentialHistogram().DataPoints().Len()
+	case pmetric.MetricTypeSummary:
+		return m.Summary().DataPoints().Len()
+	default:
+		return 0
+	}
+}
+
+func (st *storage) receiveMetrics(m pmetric.Metrics, req requestMeta, pl payload) {
+	reqId := st.receiveRequestMeta(req)
+	items := map[resId]int{}
+
+	rms := m.ResourceMetrics()
+	for i := range rms.Len() {
+		rm := rms.At(i)
+
+		resId := st.receiveResource(rm.Resource(), rm.SchemaUrl())
+
+		scms := rm.ScopeMetrics()
+		for j := range scms.Len() {
+			scm := scms.At(j)
+
+			scopeId := st.receiveScope(scm.Scope(), scm.SchemaUrl())
+
+			ms := scm.Metrics()
+			for k := range ms.Len() {
+				m := ms.At(k)
+
+				mi := metricIdentity{
+					res:   resId,
+					scope: scopeId,
+					name:  m.Name(),
+					type_: m.Type().String(),
+					unit:  m.Unit(),
+				}
+				switch m.Type() {
+				case pmetric.MetricTypeGauge:
+				case pmetric.MetricTypeSum:
+					s := m.Sum()
+					mi.tempo = s.AggregationTemporality().String()
+					mi.mono = s.IsMonotonic()
+				case pmetric.MetricTypeHistogram:
+					h := m.Histogram()
+					mi.tempo = h.AggregationTemporality().String()
+				case pmetric.MetricTypeExponentialHistogram:
+					eh := m.ExponentialHistogram()
+					mi.tempo = eh.AggregationTemporality().String()
+				case pmetric.MetricTypeSummary:
+				}
+
+				metricId := getMetricId(mi)
+
+				desc := m.Description()
+				meta := st.convertAttr(m.Metadata())
+
+				st.Lock()
+				m2, ok := st.metrics[metricId]
+				if ok {
+					if m2.desc != desc || hashValue(m2.meta) != hashValue(meta) {
+						if !m2.conflict {
+							m2.conflict = true
+							fmt.Fprintf(os.Stderr, "Warning: conflicting metadata for metric identity %+v\n", mi)
+						}
+						if len(desc) > len(m2.desc) {
+							m2.desc = desc
+						}
+					}
+				} else {
+					m2 = &metric{
+						metricIdentity: mi,
+						desc:           desc,
+						meta:           meta,
+						streams:        make(map[hashId]*metricStream),
+					}
+					st.metrics[metricId] = m2
+				}
+				st.Unlock()
+
+				items[resId] += metricPointCount(m)
+				switch m.Type() {
+				case pmetric.MetricTypeGauge:
+					st.receiveNumberPoints(reqId, m2, m.Gauge().DataPoints())
+				case pmetric.MetricTypeSum:
+					st.receiveNumberPoints(reqId, m2, m.Sum().DataPoints())
+				case pmetric.MetricTypeHistogram:
+					receiveHistolikePoints(st, reqId, m2, m.Histogram().DataPoints(), func(hlp histolikePoint, hdp pmetric.HistogramDataPoint) pointlike {
+						hp := histogramPoint{
+							histolikePoint: hlp,
+						}
+
+						uis := hdp.BucketCounts()
+						if uis.Len() > 0 {
+							hp.buckets = make([]uint64, 0, uis.Len())
+						}
+						for l := range uis.Len() {
+							hp.buckets = append(hp.buckets, uis.At(l))
+						}
+
+						fs := hdp.ExplicitBounds()
+						if fs.Len() > 0 {
+							hp.bounds = make([]float64, 0, fs.Len())
+						}
+						for l := range fs.Len() {
+							hp.bounds = append(hp.bounds, fs.At(l))
+						}
+
+						return hp
+					})
+				case pmetric.MetricTypeExponentialHistogram:
+					receiveHistolikePoints(st, reqId, m2, m.ExponentialHistogram().DataPoints(), func(hlp histolikePoint, ehdp pmetric.ExponentialHistogramDataPoint) pointlike {
+						return exponentialHistogramPoint{
+							histolikePoint: hlp,
+							scale:          ehdp.Scale(),
+							zeros:          ehdp.ZeroCount(),
+							zeroThre:       ehdp.ZeroThreshold(),
+							pos: exponentialBuckets{
+								off:     ehdp.Positive().Offset(),
+								buckets: ehdp.Positive().BucketCounts().AsRaw(),
+							},
+							neg: exponentialBuckets{
+								off:     ehdp.Negative().Offset(),
+								buckets: ehdp.Negative().BucketCounts().AsRaw(),
+							},
+						}
+					})
+
+				case pmetric.MetricTypeSummary:
+					receivePoints(st, reqId, m2, m.Summary().DataPoints(), func(p point, sp pmetric.SummaryDataPoint) pointlike {
+						qvs := sp.QuantileValues()
+						sp2 := summaryPoint{
+							point:     p,
+							count:     sp.Count(),
+							sum:       sp.Sum(),
+							quantiles: make([]quantileValue, 0, qvs.Len()),
+						}
+						for i := range qvs.Len() {
+							qv := qvs.At(i)
+							sp2.quantiles = append(sp2.quantiles, quantileValue{
+								q: qv.Quantile(),
+								v: qv.Value(),
+							})
+						}
+						return sp2
+					})
+				}
+
+				if st.verbose.Load() {
+					fmt.Printf("    metric: %s\n", jsonToString(m2))
+				}
+			}
+		}
+	}
+
+	st.receiveCall("metrics", reqId, pl, items)
+}
+
+func convertAttributeIndices(table pprofile.AttributeTableSlice, indices pcommon.Int32Slice) mapValue {
+	m := pcommon.NewMap()
+	for i := range indices.Len() {
+		idx := int(indices.At(i))
+		if idx < 0 || idx >= table.Len() {
+			continue
+		}
+		a := table.At(idx)
+		a.Value().CopyTo(m.PutEmpty(a.Key()))
+	}
+	return convertMap(m)
+}
+
+type profileTables struct {
+	pprofile.Profile
+}
+
+func (pt profileTables) str(idx int32) string {
+	strs := pt.StringTable()
+	if idx < 0 || int(idx) >= strs.Len() {
+		return ""
+	}
+	return strs.At(int(idx))
+}
+
+func (pt profileTables) valueType(vt pprofile.ValueType) valueType {
+	vt2 := valueType{
+		type_: pt.str(vt.TypeStrindex()),
+		unit:  pt.str(vt.UnitStrindex()),
+	}
+	if tempo := vt.AggregationTemporality(); tempo != pprofile.AggregationTemporalityUnspecified {
+		vt2.tempo = tempo.String()
+	}
+	return vt2
+}
+
+// Returns the frames of a location, outermost caller first
+func (pt profileTables) frames(loc pprofile.Location) []string {
+	var frames []string
+	lines := loc.Line()
+	for i := lines.Len() - 1; i >= 0; i-- {
+		line := lines.At(i)
+		funcs := pt.FunctionTable()
+		fidx := int(line.FunctionIndex())
+		if fidx < 0 || fidx >= funcs.Len() {
+			continue
+		}
+		fn := funcs.At(fidx)
+		name := pt.str(fn.NameStrindex())
+		if name == "" {
+			name = pt.str(fn.SystemNameStrindex())
+		}
+		if file := pt.str(fn.FilenameStrindex()); file != "" {
+			if line.Line() != 0 {
+				name = fmt.Sprintf("%s (%s:%d)", name, file, line.Line())
+			} else {
+				name = fmt.Sprintf("%s (%s)", name, file)
+			}
+		}
+		frames = append(frames, name)
+	}
+	if len(frames) == 0 {
+		name := fmt.Sprintf("0x%x", loc.Address())
+		if loc.HasMappingIndex() {
+			mappings := pt.MappingTable()
+			if midx := int(loc.MappingIndex()); midx >= 0 && midx < mappings.Len() {
+				if file := pt.str(mappings.At(midx).FilenameStrindex()); file != "" {
+					name = fmt.Sprintf("%s+0x%x", file, loc.Address())
+				}
+			}
+		}
+		frames = append(frames, name)
+	}
+	return frames
+}
+
+// Returns the call stack of a sample, outermost caller first
+func (pt profileTables) stack(s pprofile.Sample) []string {
+	var stack []string
+	locIndices := pt.LocationIndices()
+	locs := pt.LocationTable()
+	start := int(s.LocationsStartIndex())
+	end := start + int(s.LocationsLength())
+	for i := min(end, locIndices.Len()) - 1; i >= max(start, 0); i-- {
+		lidx := int(locIndices.At(i))
+		if lidx < 0 || lidx >= locs.Len() {
+			continue
+		}
+		stack = append(stack, pt.frames(locs.At(lidx))...)
+	}
+	return stack
+}
+
+func (st *storage) receiveProfiles(p pprofile.Profiles, req requestMeta, pl payload) {
+	reqId := st.receiveRequestMeta(req)
+	items := map[resId]int{}
+
+	rps := p.ResourceProfiles()
+	for i := range rps.Len() {
+		rp := rps.At(i)
+
+		resId := st.receiveResource(rp.Resource(), rp.SchemaUrl())
+
+		scps := rp.ScopeProfiles()
+		for j := range scps.Len() {
+			scp := scps.At(j)
+
+			scopeId := st.receiveScope(scp.Scope(), scp.SchemaUrl())
+
+			ps := scp.Profiles()
+			for k := range ps.Len() {
+				pt := profileTables{ps.At(k)}
+
+				prof := profile{
+					req:         reqId,
+					res:         resId,
+					scope:       scopeId,
+					id:          profileId(pt.ProfileID()),
+					time:        timestampValue(pt.Time()),
+					duration:    uint64(pt.Duration()),
+					periodType:  pt.valueType(pt.PeriodType()),
+					period:      pt.Period(),
+					attr:        st.redact.attrs(convertAttributeIndices(pt.AttributeTable(), pt.AttributeIndices())),
+					attrDropped: pt.DroppedAttributesCount(),
+					origFormat:  pt.OriginalPayloadFormat(),
+				}
+
+				sts := pt.SampleType()
+				defaultType := pt.str(pt.DefaultSampleTypeStrindex())
+				typeNames := make([]string, 0, sts.Len())
+				for l := range sts.Len() {
+					vt := pt.valueType(sts.At(l))
+					if vt.type_ == defaultType && defaultType != "" {
+						prof.defaultType = l
+					}
+					prof.sampleTypes = append(prof.sampleTypes, vt)
+					typeNames = append(typeNames, vt.type_)
+				}
+				prof.name = strings.Join(typeNames, ", ")
+
+				cs := pt.CommentStrindices()
+				for l := range cs.Len() {
+					prof.comments = append(prof.comments, pt.str(cs.At(l)))
+				}
+
+				links := pt.LinkTable()
+				ss := pt.Sample()
+				prof.samples = make([]sample, 0, ss.Len())
+				for l := range ss.Len() {
+					s := ss.At(l)
+					s2 := sample{
+						stack:  pt.stack(s),
+						values: s.Value().AsRaw(),
+						attr:   st.redact.attrs(convertAttributeIndices(pt.AttributeTable(), s.AttributeIndices())),
+					}
+					if lidx := int(s.LinkIndex()); s.HasLinkIndex() && lidx >= 0 && lidx < links.Len() {
+						s2.trace = traceId(links.At(lidx).TraceID())
+						s2.span = spanId(links.At(lidx).SpanID())
+					}
+					prof.samples = append(prof.samples, s2)
+				}
+				prof.sampleCount = len(prof.samples)
+				items[resId] += prof.sampleCount
+
+				if prof.time.notEmpty() {
+					prof.simpleTime = prof.time
+				} else {
+					prof.simpleTime = timestampValue(time.Now().UnixNano())
+				}
+
+				st.Lock()
+				prof.num = st.nextProf
+				st.nextProf++
+				st.profiles = append(st.profiles, prof)
+				st.Unlock()
+
+				if st.verbose.Load() {
+					fmt.Printf("    profile: %s\n", jsonToString(prof))
+				}
+			}
+		}
+	}
+
+	st.receiveCall("profiles", reqId, pl, items)
+}
+
+func clientAttributes(res resource) mapValue {
+	var attr mapValue
+	for _, p := range res.attr.Pairs {
+		if strings.HasPrefix(p.K, "service.") || strings.HasPrefix(p.K, "telemetry.sdk.") {
+			attr.add(p.K, p.V)
+		}
+	}
+	return attr
+}
+
+// Groups export calls and rejections by client; st must be locked
+func (st *storage) clientInventory() []*client {
+	clients := map[string]*client{}
+	getClient := func(req requestMeta, attr mapValue) *client {
+		c2 := client{
+			transport: req.transport,
+			peer:      req.peerHost(),
+			userAgent: req.header("User-Agent"),
+			attr:      attr,
+			items:     map[string]int{},
+		}
+		key := fmt.Sprintf("%s\x00%s\x00%s\x00%x", c2.transport, c2.peer, c2.userAgent, hashValue(attr))
+		c, ok := clients[key]
+		if !ok {
+			c = &c2
+			clients[key] = c
+		}
+		return c
+	}
+	seen := func(c *client, t timestampValue) {
+		if !c.first.notEmpty() || t < c.first {
+			c.first = t
+		}
+		if t > c.last {
+			c.last = t
+		}
+	}
+
+	for _, call := range st.calls {
+		req := st.requests[call.req]
+		if len(call.items) == 0 {
+			call.items = map[resId]int{0: 0}
+		}
+		// A call counts once for each client whose resources it carried, with
+		// its size split between them by number of items
+		items := map[*client]int{}
+		total := 0
+		for rid, n := range call.items {
+			var attr mapValue
+			if res, ok := st.resources[rid]; ok {
+				attr = clientAttributes(res)
+			}
+			c := getClient(req, attr)
+			c.items[call.signal] += n
+			items[c] += n
+			total += n
+		}
+		for c, n := range items {
+			c.requests++
+			if total == 0 {
+				c.bytes += call.wireSize / len(items)
+			} else {
+				c.bytes += call.wireSize * n / total
+			}
+			seen(c, call.time)
+		}
+	}
+
+	// A rejection goes to the client with the same transport, peer and user
+	// agent which was seen last, since its resources are unknown
+	for _, rej := range st.rejections {
+		var match *client
+		for _, c := range clients {
+			if c.transport == rej.req.transport && c.peer == rej.req.peerHost() && c.userAgent == rej.req.header("User-Agent") {
+				if match == nil || c.last > match.last || c.last == match.last && hashValue(c.attr) < hashValue(match.attr) {
+					match = c
+				}
+			}
+		}
+		if match == nil {
+			match = getClient(rej.req, mapValue{})
+		}
+		match.errors++
+		match.lastError = rej.err
+		seen(match, rej.time)
+	}
+
+	list := slices.Collect(maps.Values(clients))
+	// Most recently seen first, then in a stable order
+	slices.SortFunc(list, func(c1 *client, c2 *client) int {
+		return cmp.Or(
+			cmp.Compare(c2.last, c1.last),
+			strings.Compare(c1.transport, c2.transport),
+			strings.Compare(c1.peer, c2.peer),
+			strings.Compare(c1.userAgent, c2.userAgent),
+			cmp.Compare(hashValue(c1.attr), hashValue(c2.attr)),
+		)
+	})
+	return list
+}
@@ -0,0 +1,93 @@
+package server
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/plog"
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+func testStorage(capture bool) *storage {
+	st := newStorage(false, capture)
+	st.messages = io.Discard
+	return st
+}
+
+// An OTLP/HTTP request with the given header names and values
+func testRequest(headers ...string) requestMeta {
+	req := requestMeta{transport: "http", peer: "127.0.0.1:40000", headers: map[string][]string{}}
+	for i := 0; i+1 < len(headers); i += 2 {
+		req.headers[headers[i]] = []string{headers[i+1]}
+	}
+	return req
+}
+
+func protoPayload(t *testing.T, req exportRequest) payload {
+	t.Helper()
+	body, err := req.MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return payload{contentType: "application/x-protobuf", wireSize: len(body), size: len(body), body: body}
+}
+
+func receiveTestLogs(t *testing.T, st *storage, req requestMeta, ld plog.Logs) {
+	t.Helper()
+	st.receiveLogs(ld, req, protoPayload(t, plogotlp.NewExportRequestFromLogs(ld)))
+}
+
+func receiveTestTraces(t *testing.T, st *storage, req requestMeta, td ptrace.Traces) {
+	t.Helper()
+	st.receiveTraces(td, req, protoPayload(t, ptraceotlp.NewExportRequestFromTraces(td)))
+}
+
+// Logs with the given bodies, from a resource of the service
+func testLogs(service string, bodies ...string) plog.Logs {
+	ld := plog.NewLogs()
+	rl := ld.ResourceLogs().AppendEmpty()
+	rl.Resource().Attributes().PutStr("service.name", service)
+	lrs := rl.ScopeLogs().AppendEmpty().LogRecords()
+	for _, body := range bodies {
+		lr := lrs.AppendEmpty()
+		lr.SetTimestamp(pcommon.NewTimestampFromTime(time.Now()))
+		lr.Body().SetStr(body)
+	}
+	return ld
+}
+
+func testTraceId(b byte, last byte) pcommon.TraceID {
+	return pcommon.TraceID{b, 1, 2, 3, 4, 5, 6, 7, last, last, last, last, last, last, last, last}
+}
+
+// A trace of a server span with a client child
+func checkoutTrace(tid pcommon.TraceID, start time.Time, status ptrace.StatusCode) ptrace.Traces {
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("test")
+
+	root := ss.Spans().AppendEmpty()
+	root.SetTraceID(tid)
+	root.SetSpanID(pcommon.SpanID{tid[0], 1})
+	root.SetName("POST /checkout")
+	root.SetKind(ptrace.SpanKindServer)
+	root.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	root.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(30 * time.Millisecond)))
+	root.Status().SetCode(status)
+
+	child := ss.Spans().AppendEmpty()
+	child.SetTraceID(tid)
+	child.SetSpanID(pcommon.SpanID{tid[0], 2})
+	child.SetParentSpanID(root.SpanID())
+	child.SetName("Charge")
+	child.SetKind(ptrace.SpanKindClient)
+	child.SetStartTimestamp(pcommon.NewTimestampFromTime(start.Add(5 * time.Millisecond)))
+	child.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(20 * time.Millisecond)))
+	return td
+}
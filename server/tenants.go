@@ -0,0 +1,114 @@
+package server
+
+import (
+	"fmt"
+	"maps"
+	"net/http"
+	"net/url"
+	"slices"
+	"sync"
+)
+
+const tenantCookie = "telui-tenant"
+
+// Partitions storage by the value of a request header: each tenant gets its
+// own storage, and requests without the header go to the default tenant, which
+// is the root storage. Outputs (forwarding, NDJSON, self-telemetry) are shared.
+type tenantSet struct {
+	mutex  sync.Mutex
+	header string
+	limit  int // 0 for unlimited
+	full   bool
+	root   *storage
+	byName map[string]*storage
+}
+
+func enableTenants(st *storage, header string, limit int) {
+	st.tenants = &tenantSet{header: header, limit: limit, root: st, byName: map[string]*storage{}}
+	fmt.Fprintf(st.messages, "Separating tenants by the %s header\n", header)
+}
+
+// Returns nil for an unknown tenant, unless create is set. Once there are as
+// many tenants as the limit, new ones get the default tenant instead.
+func (ts *tenantSet) get(name string, create bool) *storage {
+	if name == "" {
+		return ts.root
+	}
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	t, ok := ts.byName[name]
+	if !ok && create && ts.limit > 0 && len(ts.byName) >= ts.limit {
+		if !ts.full {
+			ts.full = true
+			fmt.Fprintf(ts.root.messages, "Reached the limit of %d tenants, new tenants go to the default tenant\n", ts.limit)
+		}
+		return ts.root
+	}
+	if !ok && create {
+		t = &storage{sharedSettings: ts.root.sharedSettings, tenants: ts, tenant: name}
+		t.reset()
+		ts.byName[name] = t
+		fmt.Fprintf(ts.root.messages, "New tenant %q\n", name)
+	}
+	return t
+}
+
+func (ts *tenantSet) names() []string {
+	ts.mutex.Lock()
+	defer ts.mutex.Unlock()
+	return slices.Sorted(maps.Keys(ts.byName))
+}
+
+// Returns the storage of the tenant which sent the request
+func (st *storage) tenantOf(req requestMeta) *storage {
+	if st.tenants == nil {
+		return st
+	}
+	return st.tenants.get(req.header(st.tenants.header), true)
+}
+
+// The tenant header of the request, to forward it along with the request
+func (st *storage) tenantHeaders(req requestMeta) map[string]string {
+	if st.tenants == nil {
+		return nil
+	}
+	if v := req.header(st.tenants.header); v != "" {
+		return map[string]string{st.tenants.header: v}
+	}
+	return nil
+}
+
+// The default tenant first
+func (st *storage) allTenants() []*storage {
+	if st.tenants == nil {
+		return []*storage{st}
+	}
+	all := []*storage{st}
+	for _, name := range st.tenants.names() {
+		all = append(all, st.tenants.get(name, false))
+	}
+	return all
+}
+
+// The tenant selected in the UI, by the tenant query parameter or cookie.
+// A cookie naming a tenant that no longer exists selects the default tenant.
+func (st *storage) uiTenant(w http.ResponseWriter, r *http.Request) (*storage, bool) {
+	if st.tenants == nil {
+		return st, true
+	}
+	q := r.URL.Query()
+	name := q.Get("tenant")
+	if q.Has("tenant") {
+		// Keep the query string to the filters of the list endpoints
+		q.Del("tenant")
+		r.URL.RawQuery = q.Encode()
+	} else if c, err := r.Cookie(tenantCookie); err == nil {
+		name, _ = url.QueryUnescape(c.Value)
+		if st.tenants.get(name, false) == nil {
+			http.SetCookie(w, &http.Cookie{Name: tenantCookie, Path: "/", MaxAge: -1})
+			return st, true
+		}
+	}
+	t := st.tenants.get(name, false)
+	return t, t != nil
+}
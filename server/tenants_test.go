@@ -0,0 +1,145 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/collector/pdata/plog/plogotlp"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+)
+
+const testTenantHeader = "X-Scope-OrgID"
+
+func tenantRequest(name string) requestMeta {
+	if name == "" {
+		return testRequest()
+	}
+	return testRequest(testTenantHeader, name)
+}
+
+func TestTenantIsolation(t *testing.T) {
+	st := testStorage(false)
+	enableTenants(st, testTenantHeader, 0)
+	receiveTestLogs(t, st.tenantOf(tenantRequest("alice")), tenantRequest("alice"), testLogs("checkout", "alice 1", "alice 2"))
+	receiveTestLogs(t, st.tenantOf(tenantRequest("bob")), tenantRequest("bob"), testLogs("checkout", "bob"))
+	receiveTestLogs(t, st.tenantOf(tenantRequest("")), tenantRequest(""), testLogs("checkout", "default"))
+
+	alice, bob := st.tenants.get("alice", false), st.tenants.get("bob", false)
+	if alice == nil || bob == nil || alice == bob {
+		t.Fatal("alice and bob did not get their own tenants")
+	}
+	for _, tt := range []struct {
+		st   *storage
+		logs int
+	}{{st, 1}, {alice, 2}, {bob, 1}} {
+		if len(tt.st.logs) != tt.logs || len(tt.st.calls) != 1 || len(tt.st.resources) != 1 {
+			t.Errorf("tenant %q has %d logs, %d calls and %d resources, want %d, 1 and 1",
+				tt.st.tenant, len(tt.st.logs), len(tt.st.calls), len(tt.st.resources), tt.logs)
+		}
+	}
+
+	alice.reset()
+	if len(alice.logs) != 0 || len(bob.logs) != 1 || len(st.logs) != 1 {
+		t.Errorf("resetting alice left %d, %d and %d logs to alice, bob and the default tenant, want 0, 1 and 1",
+			len(alice.logs), len(bob.logs), len(st.logs))
+	}
+	if st.tenants.get("carol", false) != nil {
+		t.Error("looking up an unknown tenant created it")
+	}
+}
+
+func TestTenantLimit(t *testing.T) {
+	st := testStorage(false)
+	enableTenants(st, testTenantHeader, 1)
+	if alice := st.tenantOf(tenantRequest("alice")); alice == st {
+		t.Fatal("the first tenant went to the default tenant")
+	}
+	if bob := st.tenantOf(tenantRequest("bob")); bob != st {
+		t.Error("a tenant past the limit did not go to the default tenant")
+	}
+	if names := st.tenants.names(); len(names) != 1 {
+		t.Errorf("tenants = %v, want only alice", names)
+	}
+}
+
+func TestUiTenant(t *testing.T) {
+	st := testStorage(false)
+	enableTenants(st, testTenantHeader, 0)
+	alice := st.tenantOf(tenantRequest("alice"))
+
+	for _, tt := range []struct {
+		target  string
+		cookie  string
+		want    *storage
+		ok      bool
+		cleared bool
+	}{
+		{"/api/logs", "", st, true, false},
+		{"/api/logs?tenant=alice", "", alice, true, false},
+		{"/api/logs", "alice", alice, true, false},
+		{"/api/logs?tenant=gone", "", nil, false, false},
+		{"/api/logs", "gone", st, true, true},
+	} {
+		r := httptest.NewRequest(http.MethodGet, tt.target, nil)
+		if tt.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: tenantCookie, Value: tt.cookie})
+		}
+		w := httptest.NewRecorder()
+		got, ok := st.uiTenant(w, r)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("%s with cookie %q selected tenant %v (%v), want %v (%v)", tt.target, tt.cookie, got, ok, tt.want, tt.ok)
+		}
+		cleared := false
+		for _, c := range w.Result().Cookies() {
+			cleared = cleared || c.Name == tenantCookie && c.MaxAge < 0
+		}
+		if cleared != tt.cleared {
+			t.Errorf("%s with cookie %q: cookie cleared = %v, want %v", tt.target, tt.cookie, cleared, tt.cleared)
+		}
+		if r.URL.Query().Has("tenant") {
+			t.Errorf("%s: the tenant parameter was not removed", tt.target)
+		}
+	}
+}
+
+// Resetting a tenant forgets the spans held for it, but not those of others
+func TestTenantSamplingReset(t *testing.T) {
+	cfg := DefaultConfig()
+	cfg.TailErrors = true
+	st := testStorage(false)
+	enableTenants(st, testTenantHeader, 0)
+	stop := startSampling(st, cfg.sampling())
+	alice, bob := st.tenantOf(tenantRequest("alice")), st.tenantOf(tenantRequest("bob"))
+	receiveTestTraces(t, alice, tenantRequest("alice"), checkoutTrace(testTraceId(1, 0), time.Now(), ptrace.StatusCodeError))
+	receiveTestTraces(t, bob, tenantRequest("bob"), checkoutTrace(testTraceId(2, 0), time.Now(), ptrace.StatusCodeError))
+
+	alice.reset()
+	stop.stop()
+	if len(alice.traces) != 0 {
+		t.Errorf("alice has %d traces, want the held spans forgotten by reset", len(alice.traces))
+	}
+	if len(bob.traces) != 1 {
+		t.Errorf("bob has %d traces, want the held trace kept", len(bob.traces))
+	}
+}
+
+func TestForwardingTenantHeader(t *testing.T) {
+	url, received := testUpstream(t)
+	st := testStorage(false)
+	enableTenants(st, testTenantHeader, 0)
+	stop, err := startForwarding(st, url, nil, "none", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stop.stop()
+
+	for _, name := range []string{"alice", ""} {
+		req := plogotlp.NewExportRequestFromLogs(testLogs("checkout", "hello"))
+		st.forward.enqueue(&req, st.tenantHeaders(tenantRequest(name)))
+		if got := forwarded(t, received).header.Get(testTenantHeader); got != name {
+			t.Errorf("%s = %q, want %q", testTenantHeader, got, name)
+		}
+	}
+}
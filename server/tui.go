@@ -0,0 +1,565 @@
+package server
+
+import (
+	"cmp"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+	"unicode/utf8"
+)
+
+// The terminal UI only uses ANSI escape sequences, and stty to read keys
+// without waiting for Enter, so it works over SSH without extra dependencies.
+
+const (
+	ansiReset   = "\x1b[0m"
+	ansiReverse = "\x1b[7m"
+	ansiBold    = "\x1b[1m"
+	ansiDim     = "\x1b[2m"
+	ansiRed     = "\x1b[31m"
+	ansiGreen   = "\x1b[32m"
+	ansiYellow  = "\x1b[33m"
+	ansiBlue    = "\x1b[34m"
+	ansiMagenta = "\x1b[35m"
+	ansiCyan    = "\x1b[36m"
+	ansiGray    = "\x1b[90m"
+)
+
+var severityColors = map[string]string{
+	"Trace": ansiGray,
+	"Debug": ansiGray,
+	"Info":  ansiGreen,
+	"Warn":  ansiYellow,
+	"Error": ansiRed,
+	"Fatal": ansiMagenta,
+}
+
+var sparkChars = []rune("▁▂▃▄▅▆▇█")
+
+func stty(args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = os.Stdin
+	out, err := cmd.Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func terminalSize() (int, int) {
+	out, err := stty("size")
+	if err == nil {
+		if rows, cols, ok := strings.Cut(out, " "); ok {
+			h, err1 := strconv.Atoi(rows)
+			w, err2 := strconv.Atoi(cols)
+			if err1 == nil && err2 == nil && w > 0 && h > 0 {
+				return w, h
+			}
+		}
+	}
+	return 80, 24
+}
+
+// Pads or truncates s to exactly n columns
+func fitText(s string, n int) string {
+	if n <= 0 {
+		return ""
+	}
+	l := utf8.RuneCountInString(s)
+	if l <= n {
+		return s + strings.Repeat(" ", n-l)
+	}
+	r := []rune(s)
+	return string(r[:n-1]) + "…"
+}
+
+func sparkline(values []float64, n int) string {
+	if len(values) > n {
+		values = values[len(values)-n:]
+	}
+	if len(values) == 0 {
+		return strings.Repeat(" ", n)
+	}
+	lo, hi := slices.Min(values), slices.Max(values)
+	var b strings.Builder
+	for _, v := range values {
+		i := len(sparkChars) / 2
+		if hi > lo {
+			i = int((v - lo) / (hi - lo) * float64(len(sparkChars)-1))
+		}
+		b.WriteRune(sparkChars[i])
+	}
+	b.WriteString(strings.Repeat(" ", n-len(values)))
+	return b.String()
+}
+
+func formatTuiTime(t timestampValue) string {
+	if t == 0 {
+		return "--:--:--.---"
+	}
+	return time.Unix(0, int64(t)).Format("15:04:05.000")
+}
+
+type tuiTrace struct {
+	id    traceId
+	start timestampValue
+	end   timestampValue
+	spans int
+	root  string
+	err   bool
+}
+
+type tuiSpan struct {
+	depth int
+	span
+}
+
+type tuiStream struct {
+	service string
+	name    string
+	attr    string
+	unit    string
+	values  []float64
+}
+
+// Status messages are shown on the last line but one while the terminal UI is
+// running, instead of being written over it
+type tuiStatus struct {
+	mutex   sync.Mutex
+	out     io.Writer // while the terminal UI is not running
+	running bool
+	last    string
+}
+
+func (s *tuiStatus) Write(p []byte) (int, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.running {
+		return s.out.Write(p)
+	}
+	lines := strings.Split(strings.TrimSpace(string(p)), "\n")
+	if line := strings.TrimSpace(lines[len(lines)-1]); line != "" {
+		s.last = line
+	}
+	return len(p), nil
+}
+
+func (s *tuiStatus) setRunning(running bool) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.running, s.last = running, ""
+}
+
+func (s *tuiStatus) message() string {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return s.last
+}
+
+type tui struct {
+	st     *storage
+	status *tuiStatus
+	view   int // 0: traces, 1: logs, 2: metrics
+	width  int
+	height int
+
+	traceSel     traceId // once a trace is picked, it stays selected as new ones arrive
+	traceIdx     int
+	logScroll    int // lines from the bottom, 0 to follow new logs
+	metricScroll int
+}
+
+var tuiViews = []string{"Traces", "Logs", "Metrics"}
+
+func (t *tui) service(res resId) string {
+	return t.st.serviceName(res)
+}
+
+// Most recent first
+func (t *tui) traces() []tuiTrace {
+	var trs []tuiTrace
+	for tid, tr := range t.st.traces {
+		tt := tuiTrace{id: tid, spans: len(tr.spans)}
+		for _, sp := range tr.spans {
+			if tt.start == 0 || sp.start < tt.start {
+				tt.start = sp.start
+			}
+			tt.end = max(tt.end, sp.end)
+			if _, ok := tr.spans[sp.parent]; !ok {
+				tt.root = sp.name
+			}
+			tt.err = tt.err || sp.status == "Error"
+		}
+		trs = append(trs, tt)
+	}
+	slices.SortFunc(trs, func(a, b tuiTrace) int {
+		return cmp.Or(cmp.Compare(b.start, a.start), strings.Compare(a.id.toString(), b.id.toString()))
+	})
+	return trs
+}
+
+// Depth-first, children ordered by start time
+func (t *tui) waterfall(tid traceId) []tuiSpan {
+	tr, ok := t.st.traces[tid]
+	if !ok {
+		return nil
+	}
+	roots, children := tr.tree()
+	byStart := func(a, b spanId) int { return cmp.Compare(tr.spans[a].start, tr.spans[b].start) }
+	var out []tuiSpan
+	var visit func(sid spanId, depth int)
+	visit = func(sid spanId, depth int) {
+		out = append(out, tuiSpan{depth, tr.spans[sid]})
+		slices.SortFunc(children[sid], byStart)
+		for _, c := range children[sid] {
+			visit(c, depth+1)
+		}
+	}
+	slices.SortFunc(roots, byStart)
+	for _, r := range roots {
+		visit(r, 0)
+	}
+	return out
+}
+
+func (t *tui) streams() []tuiStream {
+	var out []tuiStream
+	for _, me := range t.st.metrics {
+		for _, ms := range me.streams {
+			ts := tuiStream{
+				service: t.service(me.res),
+				name:    me.name,
+				attr:    attrSummary(ms.attr),
+				unit:    me.unit,
+			}
+			for _, pt := range ms.points {
+				if v, ok := pointScalar(pt); ok {
+					ts.values = append(ts.values, v)
+				}
+			}
+			out = append(out, ts)
+		}
+	}
+	slices.SortFunc(out, func(a, b tuiStream) int {
+		return cmp.Or(strings.Compare(a.service, b.service), strings.Compare(a.name, b.name), strings.Compare(a.attr, b.attr))
+	})
+	return out
+}
+
+func attrSummary(attr mapValue) string {
+	var parts []string
+	for _, p := range attr.Pairs {
+		parts = append(parts, p.K+"="+attrString(p.V))
+	}
+	return strings.Join(parts, " ")
+}
+
+// Gauges and sums show their value, distributions their mean
+func pointScalar(pt pointlike) (float64, bool) {
+	var count uint64
+	var sum float64
+	switch pt := pt.(type) {
+	case numberPoint:
+		switch v := pt.value.(type) {
+		case intValue:
+			return float64(v), true
+		case doubleValue:
+			return float64(v), true
+		}
+		return 0, false
+	case histogramPoint:
+		count, sum = pt.count, pt.sum
+	case exponentialHistogramPoint:
+		count, sum = pt.count, pt.sum
+	case summaryPoint:
+		count, sum = pt.count, pt.sum
+	}
+	if count == 0 {
+		return 0, false
+	}
+	return sum / float64(count), true
+}
+
+func (t *tui) header(b *strings.Builder) {
+	b.WriteString(ansiBold + " telui " + ansiReset)
+	for i, name := range tuiViews {
+		label := fmt.Sprintf(" %d %s ", i+1, name)
+		if i == t.view {
+			b.WriteString(ansiReverse + label + ansiReset)
+		} else {
+			b.WriteString(label)
+		}
+	}
+	fmt.Fprintf(b, ansiDim+"  %d traces, %d logs, %d metrics"+ansiReset+"\r\n",
+		len(t.st.traces), len(t.st.logs), len(t.st.metrics))
+}
+
+// Placeholder until the next draw resolves the trace at traceIdx
+var pickedTrace = traceId{0xff}
+
+func (t *tui) drawTraces(b *strings.Builder, lines int) {
+	trs := t.traces()
+	if len(trs) == 0 {
+		b.WriteString("No traces.\r\n")
+		return
+	}
+	if i := slices.IndexFunc(trs, func(tt tuiTrace) bool { return tt.id == t.traceSel }); i != -1 {
+		t.traceIdx = i
+	}
+	t.traceIdx = max(0, min(t.traceIdx, len(trs)-1))
+
+	listLines := max(3, lines/3)
+	first := max(0, min(t.traceIdx-listLines/2, len(trs)-listLines))
+	for i := first; i < min(len(trs), first+listLines); i++ {
+		tt := trs[i]
+		line := fmt.Sprintf(" %s  %s  %10s  %4d spans  %s", formatTuiTime(tt.start), tt.id.toString(),
+			time.Duration(tt.end-tt.start).Round(time.Microsecond), tt.spans, tt.root)
+		line = fitText(line, t.width)
+		switch {
+		case i == t.traceIdx:
+			line = ansiReverse + line + ansiReset
+		case tt.err:
+			line = ansiRed + line + ansiReset
+		}
+		b.WriteString(line + "\r\n")
+	}
+	lines -= min(len(trs), listLines) + 1
+	b.WriteString(ansiDim + strings.Repeat("─", t.width) + ansiReset + "\r\n")
+
+	tt := trs[t.traceIdx]
+	if t.traceSel.notEmpty() {
+		t.traceSel = tt.id
+	}
+	dur := max(1, float64(tt.end-tt.start))
+	nameWidth := t.width * 2 / 5
+	barWidth := max(10, t.width-nameWidth-12)
+	for i, ts := range t.waterfall(tt.id) {
+		if i >= lines {
+			break
+		}
+		name := fitText(strings.Repeat("  ", ts.depth)+ts.name, nameWidth)
+		from := int(float64(ts.start-tt.start) / dur * float64(barWidth))
+		length := max(1, int(float64(ts.end-ts.start)/dur*float64(barWidth)))
+		from = min(from, barWidth-1)
+		length = min(length, barWidth-from)
+		color := ansiCyan
+		if ts.status == "Error" {
+			color = ansiRed
+		}
+		bar := strings.Repeat(" ", from) + color + strings.Repeat("█", length) + ansiReset + strings.Repeat(" ", barWidth-from-length)
+		fmt.Fprintf(b, "%s %s %10s\r\n", name, bar, time.Duration(ts.end-ts.start).Round(time.Microsecond))
+	}
+}
+
+func (t *tui) drawLogs(b *strings.Builder, lines int) {
+	logs := t.st.logs
+	if len(logs) == 0 {
+		b.WriteString("No logs.\r\n")
+		return
+	}
+	t.logScroll = max(0, min(t.logScroll, len(logs)-lines))
+	end := len(logs) - t.logScroll
+	for _, l := range logs[max(0, end-lines):end] {
+		sev := strings.TrimRight(l.sev, "234")
+		color := severityColors[sev]
+		service := fitText(t.service(l.res), 16)
+		prefix := fmt.Sprintf("%s %s%-6s%s %s ", formatTuiTime(l.simpleTime), color, l.sev, ansiReset, service)
+		b.WriteString(prefix + fitText(l.simpleBody, t.width-43) + "\r\n")
+	}
+}
+
+func (t *tui) drawMetrics(b *strings.Builder, lines int) {
+	streams := t.streams()
+	if len(streams) == 0 {
+		b.WriteString("No metrics.\r\n")
+		return
+	}
+	t.metricScroll = max(0, min(t.metricScroll, len(streams)-lines))
+	sparkWidth := max(10, t.width/3)
+	labelWidth := t.width - sparkWidth - 16
+	for _, ts := range streams[t.metricScroll:min(len(streams), t.metricScroll+lines)] {
+		label := ts.service + " " + ansiBold + ts.name + ansiReset
+		if ts.attr != "" {
+			label += " " + ansiDim + ts.attr + ansiReset
+		}
+		// fitText counts escape sequences too, so pad by hand
+		visible := utf8.RuneCountInString(ts.service+" "+ts.name) + 1 + utf8.RuneCountInString(ts.attr)
+		if ts.attr == "" {
+			visible--
+		}
+		if visible > labelWidth {
+			label = fitText(ts.service+" "+ts.name+" "+ts.attr, labelWidth)
+		} else {
+			label += strings.Repeat(" ", labelWidth-visible)
+		}
+		last := ""
+		if len(ts.values) > 0 {
+			last = strconv.FormatFloat(ts.values[len(ts.values)-1], 'g', 6, 64) + " " + ts.unit
+		}
+		fmt.Fprintf(b, "%s %s%s%s %s\r\n", label, ansiBlue, sparkline(ts.values, sparkWidth), ansiReset, fitText(last, 14))
+	}
+}
+
+var tuiHelp = []string{
+	"↑/↓ select trace   Home follow newest   1-3/Tab switch view   q quit",
+	"↑/↓ scroll   End follow   1-3/Tab switch view   q quit",
+	"↑/↓ scroll   1-3/Tab switch view   q quit",
+}
+
+func (t *tui) draw() {
+	t.width, t.height = terminalSize()
+	var b strings.Builder
+	b.WriteString("\x1b[H\x1b[2J")
+	t.st.Lock()
+	t.header(&b)
+	lines := t.height - 2
+	msg := t.status.message()
+	if msg != "" {
+		lines--
+	}
+	switch t.view {
+	case 0:
+		t.drawTraces(&b, lines)
+	case 1:
+		t.drawLogs(&b, lines)
+	case 2:
+		t.drawMetrics(&b, lines)
+	}
+	t.st.Unlock()
+	if msg != "" {
+		fmt.Fprintf(&b, "\x1b[%d;1H%s", t.height-1, fitText(msg, t.width))
+	}
+	fmt.Fprintf(&b, "\x1b[%d;1H%s%s%s", t.height, ansiDim, fitText(tuiHelp[t.view], t.width), ansiReset)
+	os.Stdout.WriteString(b.String())
+}
+
+func (t *tui) key(k string) bool {
+	switch k {
+	case "q", "Q":
+		return false
+	case "1", "2", "3":
+		t.view = int(k[0] - '1')
+	case "\t":
+		t.view = (t.view + 1) % len(tuiViews)
+	case "up", "k":
+		switch t.view {
+		case 0:
+			t.traceIdx--
+			t.traceSel = pickedTrace
+		case 1:
+			t.logScroll++
+		case 2:
+			t.metricScroll--
+		}
+	case "down", "j":
+		switch t.view {
+		case 0:
+			t.traceIdx++
+			t.traceSel = pickedTrace
+		case 1:
+			t.logScroll--
+		case 2:
+			t.metricScroll++
+		}
+	case "home", "g":
+		t.traceIdx, t.traceSel = 0, traceId{}
+		t.metricScroll = 0
+	case "end", "G":
+		t.logScroll = 0
+	}
+	return true
+}
+
+// Stops once done is closed. When polling, reads return nothing after a
+// timeout set with stty, so done is checked even without key presses.
+func readKeys(keys chan<- string, done <-chan struct{}, poll bool) {
+	buf := make([]byte, 16)
+	for {
+		select {
+		case <-done:
+			return
+		default:
+		}
+		n, err := os.Stdin.Read(buf)
+		if poll && err == io.EOF {
+			continue
+		}
+		if err != nil {
+			close(keys)
+			return
+		}
+		s := string(buf[:n])
+		switch s {
+		case "\x1b[A", "\x1bOA":
+			s = "up"
+		case "\x1b[B", "\x1bOB":
+			s = "down"
+		case "\x1b[H", "\x1bOH", "\x1b[1~":
+			s = "home"
+		case "\x1b[F", "\x1bOF", "\x1b[4~":
+			s = "end"
+		}
+		select {
+		case keys <- s:
+		case <-done:
+			return
+		}
+	}
+}
+
+// Draws the terminal UI until q is pressed or telui is interrupted
+func runTui(st *storage, status *tuiStatus) {
+	saved, err := stty("-g")
+	poll := false
+	if err == nil {
+		_, rawErr := stty("-icanon", "-echo", "min", "0", "time", "1")
+		poll = rawErr == nil
+	}
+	keys := make(chan string)
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		readKeys(keys, done, poll)
+	}()
+	status.setRunning(true)
+	os.Stdout.WriteString("\x1b[?1049h\x1b[?25l") // alternate screen, hide cursor
+	defer func() {
+		os.Stdout.WriteString("\x1b[?25h\x1b[?1049l")
+		status.setRunning(false)
+		close(done)
+		// Without polling, the reader stays blocked until the next key or the
+		// end of input, which is harmless once telui exits
+		if poll {
+			<-stopped
+		}
+		if err == nil {
+			stty(saved)
+		}
+	}()
+
+	interrupt := make(chan os.Signal, 1)
+	signal.Notify(interrupt, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(interrupt)
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+
+	t := &tui{st: st, status: status}
+	for {
+		t.draw()
+		select {
+		case <-interrupt:
+			return
+		case k, ok := <-keys:
+			if !ok || !t.key(k) {
+				return
+			}
+		case <-ticker.C:
+		}
+	}
+}
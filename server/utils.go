@@ -0,0 +1,59 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+)
+
+type server interface {
+	Serve(net.Listener) error
+}
+
+// Listens on localhost (127.0.0.1 and ::1) if host is empty. Port 0 picks a
+// free port, which is returned.
+func listenAndServe(st *storage, s server, desc string, host string, port int) (int, error) {
+	hosts := []string{"127.0.0.1", "::1"}
+	if host != "" {
+		hosts = []string{host}
+	}
+	for _, host := range hosts {
+		listener, err := net.Listen("tcp", net.JoinHostPort(host, strconv.Itoa(port)))
+		if err != nil {
+			return 0, err
+		}
+		port = listener.Addr().(*net.TCPAddr).Port
+		go func() {
+			err := s.Serve(listener)
+			if err != nil && !errors.Is(err, http.ErrServerClosed) {
+				fmt.Fprintf(os.Stderr, "Fatal error in %s server: %v\n", desc, err)
+			}
+		}()
+	}
+	if host != "" {
+		fmt.Fprintf(st.messages, "Started %s endpoint on %s\n", desc, net.JoinHostPort(host, strconv.Itoa(port)))
+	} else {
+		fmt.Fprintf(st.messages, "Started %s endpoint on port %d\n", desc, port)
+	}
+	return port, nil
+}
+
+type countingReader struct {
+	io.Reader
+	n int
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.Reader.Read(p)
+	cr.n += n
+	return n, err
+}
+
+type countingReadCloser struct {
+	countingReader
+	io.Closer
+}
@@ -1,4 +1,4 @@
-package main
+package server
 
 import (
 	"encoding/binary"
@@ -52,6 +52,14 @@ func (a *arrayValue) add(v hashableValue) {
 func (m *mapValue) add(k string, v hashableValue) {
 	m.Pairs = append(m.Pairs, pair{K: k, V: v})
 }
+func (m mapValue) get(k string) (hashableValue, bool) {
+	for _, p := range m.Pairs {
+		if p.K == k {
+			return p.V, true
+		}
+	}
+	return nil, false
+}
 func (m mapValue) notEmpty() bool {
 	return len(m.Pairs) > 0
 }
@@ -94,6 +102,67 @@ func convertMap(m pcommon.Map) (m2 mapValue) {
 	return
 }
 
+func putValue(dst pcommon.Value, v hashableValue) {
+	switch v := v.(type) {
+	case boolValue:
+		dst.SetBool(bool(v))
+	case intValue:
+		dst.SetInt(int64(v))
+	case doubleValue:
+		dst.SetDouble(float64(v))
+	case stringValue:
+		dst.SetStr(string(v))
+	case bytesValue:
+		dst.SetEmptyBytes().FromRaw([]byte(v))
+	case arrayValue:
+		s := dst.SetEmptySlice()
+		for _, x := range v.Items {
+			putValue(s.AppendEmpty(), x)
+		}
+	case mapValue:
+		v.copyTo(dst.SetEmptyMap())
+	default:
+		panic("unknown value type")
+	}
+}
+func (m mapValue) copyTo(dst pcommon.Map) {
+	for _, p := range m.Pairs {
+		putValue(dst.PutEmpty(p.K), p.V)
+	}
+}
+
+func toGo(v value) any {
+	switch v := v.(type) {
+	case boolValue:
+		return bool(v)
+	case intValue:
+		return int64(v)
+	case doubleValue:
+		return float64(v)
+	case stringValue:
+		return string(v)
+	case bytesValue:
+		return []byte(v)
+	case arrayValue:
+		a := make([]any, 0, len(v.Items))
+		for _, x := range v.Items {
+			a = append(a, toGo(x))
+		}
+		return a
+	case mapValue:
+		return v.toGo()
+	default:
+		return nil
+	}
+}
+func (m mapValue) toGo() map[string]any {
+	m2 := make(map[string]any, len(m.Pairs))
+	for _, p := range m.Pairs {
+		m2[p.K] = toGo(p.V)
+	}
+	return m2
+}
+
 func forceWrite(w io.Writer, b []byte) {
 	_, err := w.Write(b)
 	if err != nil {
@@ -0,0 +1,40 @@
+async function updateClients() {
+	const clients = await fetchData("/api/clients");
+	const clientTemplate = document.querySelector("#client-template");
+	const clientRowTemplate = document.querySelector("#client-row-template");
+	if(clients.length == 0) {
+		document.querySelector(`#body`).replaceChildren(document.createTextNode("No clients."));
+		return;
+	}
+	const clientsContent = clientTemplate.content.cloneNode(true);
+	clientsContent.querySelector("tbody").replaceChildren(...clients.map(client => {
+		const clientId = [client.transport, client.peer, client["user.agent"], JSON.stringify(client.attr ?? {})].join("|");
+		const rowContent = clientRowTemplate.content.cloneNode(true);
+		const rowNode = rowContent.querySelector(".client");
+		const attr = client.attr ?? {};
+		rowContent.querySelector(".client-service").innerText = attr["service.name"] ?? "";
+		const sdk = [attr["telemetry.sdk.name"], attr["telemetry.sdk.language"], attr["telemetry.sdk.version"]];
+		rowContent.querySelector(".client-sdk").innerText = sdk.filter(x => x != undefined).join(" ");
+		rowContent.querySelector(".client-peer").innerText = `${client.transport} ${client.peer}`;
+		rowContent.querySelector(".client-agent").innerText = client["user.agent"] ?? "";
+		rowContent.querySelector(".client-requests").innerText = client.requests;
+		rowContent.querySelector(".client-items").innerText =
+			sortedEntries(client.items).map(([signal, n]) => `${n} ${signal}`).join(", ");
+		rowContent.querySelector(".client-bytes").innerText = formatSize(client.bytes);
+		if(client.first) {
+			rowContent.querySelector(".client-first").innerText = timestamp(client.first._ts, true);
+			rowContent.querySelector(".client-last").innerText = timestamp(client.last._ts, true);
+		}
+		const errorsNode = rowContent.querySelector(".client-errors");
+		errorsNode.innerText = client.errors;
+		if(client.errors > 0) errorsNode.classList.add("client-has-errors");
+		rowNode.id = `item-client-${clientId}`;
+		rowNode.addEventListener("click", () => {
+			selectItem(`client-${clientId}`, `Client ${client.transport} ${client.peer}`);
+			setPanelBody(renderMap({}, client));
+		});
+		return rowContent;
+	}));
+	document.querySelector(`#body`).replaceChildren(clientsContent);
+	updateSelectedItems();
+}
@@ -0,0 +1,24 @@
+async function updateDiagnostics() {
+	const rejections = await fetchData("/api/rejections");
+	rejections.reverse();
+	const rejectionTemplate = document.querySelector("#rejection-template");
+	document.querySelector(`#body`).replaceChildren(
+		...(rejections.length == 0 ? [document.createTextNode("No rejected requests.")] : rejections.map(rej => {
+			const rejId = String(rej.time._ts);
+			const rejectionContent = rejectionTemplate.content.cloneNode(true);
+			const rejectionNode = rejectionContent.querySelector(".rejection");
+			rejectionContent.querySelector(".rejection-time").innerText = timestamp(rej.time._ts, true);
+			rejectionContent.querySelector(".rejection-signal").innerText = rej.signal;
+			rejectionContent.querySelector(".rejection-peer").innerText = `${rej.request.transport} ${rej.request.peer ?? ""}`;
+			rejectionContent.querySelector(".rejection-status").innerText = rej.status ?? "";
+			rejectionContent.querySelector(".rejection-error").innerText = rej.error;
+			rejectionNode.id = `item-rejection-${rejId}`;
+			rejectionNode.addEventListener("click", () => {
+				selectItem(`rejection-${rejId}`, `Rejected ${rej.signal} request`);
+				setPanelBody(renderMap({}, rej));
+			});
+			return rejectionContent;
+		}))
+	);
+	updateSelectedItems();
+}
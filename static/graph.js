@@ -53,6 +53,13 @@ class Graph {
 		};
 		this.canvas.addEventListener("mousemove", mouseIn);
 		this.canvas.addEventListener("mouseenter", mouseIn);
+		this.canvas.addEventListener("click", async () => {
+			const exemplar = this.focus?.exemplar;
+			if(exemplar?.received && !await goToSpan(exemplar.traceId, exemplar.spanId)) {
+				exemplar.received = false;
+				this.render();
+			}
+		});
 		this.graphNode.addEventListener("mouseleave", () => {
 			this.defocusTimeout = setTimeout(() => {
 				this.mousePos = null;
@@ -89,6 +96,12 @@ class Graph {
 		this.points.push({time, value, style, props});
 	}
 
+	// Drawn as a circle which leads to the span when clicked
+	addExemplar(time, value, props, traceId, spanId, received) {
+		this.addPoint(received ? "#f80" : "#666", time, value, props);
+		this.points.at(-1).exemplar = { traceId, spanId, received };
+	}
+
 	render() {
 		const w = this.canvas.width;
 		const h = this.canvas.height
@@ -156,6 +169,12 @@ class Graph {
 			ctx.lineTo(x, y+sz);
 			ctx.fill();
 		};
+		const drawCircle = (x, y, sz, style) => {
+			ctx.fillStyle = style;
+			ctx.beginPath();
+			ctx.arc(x, y, sz, 0, 2*Math.PI);
+			ctx.fill();
+		};
 		const drawLine = (x, sz, style) => {
 			ctx.lineWidth = sz;
 			ctx.strokeStyle = style;
@@ -167,7 +186,13 @@ class Graph {
 
 		for(const pt of this.points) {
 			const x = pointX(pt);
-			if(pt.value != undefined) {
+			if(pt.exemplar) {
+				const y = pointY(pt);
+				if(pt == focus) {
+					drawCircle(x, y, ptSz * 1.2, "#fff");
+				}
+				drawCircle(x, y, ptSz * 0.8, pt.exemplar.received ? pt.style : "#666");
+			} else if(pt.value != undefined) {
 				const y = pointY(pt);
 				if(pt == focus) {
 					drawDiamond(x, y, ptSz * 1.5, "#fff");
@@ -186,7 +211,20 @@ class Graph {
 		this.labels.minValue.innerText = formatValue(this.minValue);
 		this.labels.maxValue.innerText = formatValue(this.maxValue);
 
-		if(focus) {
+		this.focus = focus;
+		this.canvas.classList.toggle("graph-link", focus?.exemplar?.received ?? false);
+		if(focus?.exemplar) {
+			const hint = document.createElement("div");
+			hint.classList.add("graph-exemplar-hint");
+			if(focus.exemplar.received) {
+				hint.innerText = "Exemplar: click to go to its span";
+			} else if(focus.exemplar.traceId) {
+				hint.innerText = "Exemplar: trace not received";
+			} else {
+				hint.innerText = "Exemplar without trace";
+			}
+			this.pointProps.replaceChildren(hint, ...renderMap(this.ctx, focus.props));
+		} else if(focus) {
 			this.pointProps.replaceChildren(...renderMap(this.ctx, focus.props));
 		} else {
 			this.pointProps.replaceChildren();
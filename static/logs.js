@@ -1,30 +1,38 @@
 async function updateLogs() {
 	const logs = await fetchData("/api/logs");
-	for(let i = 0; i < logs.length; i++) {
-		logs[i].id = i;
-	}
 	logs.sort((l1, l2) => cmp(l1.time._ts, l2.time._ts));
-	const logTemplate = document.querySelector("#log-template");
 	document.querySelector(`#body`).replaceChildren(
 		...(logs.length == 0 ? [document.createTextNode("No logs.")] : logs.map(log => {
-			const logContent = logTemplate.content.cloneNode(true);
-			const logNode = logContent.querySelector(".log");
-			logContent.querySelector(".log-time").innerText = timestamp(log.time._ts, true);
-			logContent.querySelector(".log-sev").innerText = log.sev;
-			logContent.querySelector(".log-body").innerText = log.body;
-			if(log.sev.startsWith("Debug")) logNode.classList.add("log-debug");
-			if(log.sev.startsWith("Warn")) logNode.classList.add("log-warn");
-			if(log.sev.startsWith("Error")) logNode.classList.add("log-error");
-			logNode.id = `item-log-${log.id}`;
-			logNode.addEventListener("click", () => {
-				selectLog(log.id);
-			});
+			const logContent = renderLogLine(log);
+			logContent.querySelector(".log").id = `item-log-${log.id}`;
 			return logContent;
 		}))
 	);
 	updateSelectedItems();
 }
 
+// With the span ID if the log has one and showSpan is set
+function renderLogLine(log, showSpan) {
+	const logContent = document.querySelector("#log-template").content.cloneNode(true);
+	const logNode = logContent.querySelector(".log");
+	logContent.querySelector(".log-time").innerText = timestamp(log.time._ts, true);
+	logContent.querySelector(".log-sev").innerText = log.sev;
+	logContent.querySelector(".log-body").innerText = log.body;
+	if(showSpan && log.span) {
+		const spanNode = document.createElement("span");
+		spanNode.classList.add("log-span");
+		spanNode.innerText = log.span;
+		logNode.insertBefore(spanNode, logContent.querySelector(".log-body"));
+	}
+	if(log.sev.startsWith("Debug")) logNode.classList.add("log-debug");
+	if(log.sev.startsWith("Warn")) logNode.classList.add("log-warn");
+	if(log.sev.startsWith("Error")) logNode.classList.add("log-error");
+	logNode.addEventListener("click", () => {
+		selectLog(log.id);
+	});
+	return logContent;
+}
+
 async function selectLog(logId) {
 	selectItem(`log-${logId}`, `Log ${logId}`);
 	
@@ -37,5 +45,10 @@ async function selectLog(logId) {
 		return;
 	}
 
+	setPanelActions(
+		pinAction("log", logId, data.pin),
+		deleteAction("Delete log", `/api/log/${logId}`),
+		resourceDeletion(data.log.res._res, data.resource),
+	);
 	setPanelBody(renderMap(data, data.log));
 }
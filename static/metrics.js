@@ -88,6 +88,11 @@ async function selectMetric(metricId, metric) {
 		}
 
 		const metric = data.metric;
+		setPanelActions(
+			pinAction("metric", metricId, data.pin),
+			deleteAction("Delete metric", `/api/metric/${metricId}`),
+			resourceDeletion(metric.res._res, data.resource),
+		);
 
 		let children = [];
 		if(metric.conflict) {
@@ -106,10 +111,21 @@ async function selectMetric(metricId, metric) {
 			streamNode.querySelector(".metric-stream-attrs").replaceChildren(...renderMap(data, stream.attr));
 			const graph = Graph.getGraph(streamId, streamNode.querySelector(".metric-stream-points"));
 			graph.setContext(data);
+			// Exemplar values take the type of the plotted values, so they share their scale
+			const addExemplars = (pt, like) => {
+				for(const ex of pt.examplars ?? []) {
+					const traceId = ex.span?._trace;
+					const spanId = ex.span?._span;
+					const received = (data["exemplar.traces"][traceId] ?? false) && spanId != "0000000000000000";
+					const value = typeof like == "bigint" ? BigInt(Math.round(Number(ex.value))) : Number(ex.value);
+					graph.addExemplar(ex.time._ts, value, ex, traceId, spanId, received);
+				}
+			};
 			
 			if(metric.type == "Gauge" || metric.type == "Sum") {
 				for(const pt of stream.pts) {
 					graph.addPoint("#0f0", pt.time._ts, pt.val, pt);
+					addExemplars(pt, pt.val);
 				}
 			} else if(metric.type == "Histogram" || metric.type == "ExponentialHistogram" || metric.type == "Summary") {
 
@@ -192,6 +208,7 @@ async function selectMetric(metricId, metric) {
 					if(pt.sum != undefined) {
 						graph.addPoint("#ff0", pt.time._ts, pt.sum / Number(pt.cnt));
 					}
+					addExemplars(pt, 0);
 				}
 			}
 
@@ -1,9 +1,11 @@
 const panel = document.querySelector("#panel");
 const panelTitle = document.querySelector("#panel-title");
 const panelBody = document.querySelector("#panel-body");
+const panelActions = document.querySelector("#panel-actions");
 
 let selectedItemId = undefined;
 let panelUpdater = undefined;
+let scrollToSelected = false;
 
 function updateSelectedItems() {
 	for(const el of document.querySelectorAll(".selected")) {
@@ -13,6 +15,10 @@ function updateSelectedItems() {
 		const itemNode = document.querySelector("#item-" + selectedItemId);
 		if(itemNode) {
 			itemNode.classList.add("selected");
+			if(scrollToSelected) {
+				itemNode.scrollIntoView({ block: "center" });
+				scrollToSelected = false;
+			}
 		}
 	}
 }
@@ -23,6 +29,7 @@ function selectItem(itemId, title) {
 	updateSelectedItems();
 
 	panelTitle.innerText = title;
+	panelActions.replaceChildren();
 	panelBody.innerText = "Loading...";
 	panel.hidden = false;
 }
@@ -35,18 +42,90 @@ function setPanelUpdater(updater) {
 	panelUpdater = updater;
 }
 
+function setPanelActions(...actions) {
+	panelActions.replaceChildren(...actions);
+}
+
+// Sends a DELETE request to the URL, then closes the panel
+function deleteAction(label, url) {
+	const link = document.createElement("a");
+	link.innerText = label;
+	link.addEventListener("click", async () => {
+		if(!confirm(`${label}?`)) return;
+		let pinned = 0;
+		try {
+			const res = await fetch(url, { method: "DELETE" });
+			if(res.status == 409) {
+				alert("This item is pinned, unpin it before deleting it.");
+				return;
+			}
+			if(!res.ok) throw new Error(`Request returned code ${res.status}`);
+			pinned = Number(JSON.parse(await res.text()).pinned?._int ?? 0);
+		} catch(err) {
+			console.error(err);
+			return;
+		}
+		if(pinned > 0) alert(`${pinned} pinned items were kept.`);
+		closePanel();
+		updateTab();
+	});
+	return link;
+}
+
+// Deletes everything from the service, or from the resource if it has no service.name
+function resourceDeletion(resId, resource) {
+	const service = resource?.attr?.["service.name"];
+	if(typeof service == "string") {
+		return deleteAction(`Delete all from ${service}`, `/api/service/${encodeURIComponent(service)}`);
+	}
+	return deleteAction("Delete all from resource", `/api/resource/${resId}`);
+}
+
+// Toggles the pin of a trace, log or metric, asking for an optional note
+function pinAction(kind, id, pin) {
+	const link = document.createElement("a");
+	const update = () => {
+		link.innerText = pin ? "Unpin" : "Pin";
+		link.title = pin ? (pin.note ?? "Pinned") : `Keep this ${kind} when resetting`;
+	};
+	update();
+	link.addEventListener("click", async () => {
+		const url = `/api/pin/${kind}/${id}`;
+		let newPin;
+		let req = { method: "DELETE" };
+		if(!pin) {
+			const note = prompt(`Pin this ${kind}, with an optional note:`);
+			if(note == null) return;
+			newPin = note ? { note } : {};
+			req = { method: "PUT", body: JSON.stringify(newPin) };
+		}
+		try {
+			const res = await fetch(url, req);
+			if(!res.ok) throw new Error(`Request returned code ${res.status}`);
+		} catch(err) {
+			console.error(err);
+			return;
+		}
+		pin = newPin;
+		update();
+		if(location.hash == "#pinned") updateTab();
+	});
+	return link;
+}
+
 async function updatePanel() {
 	if(panelUpdater) {
 		await panelUpdater();
 	}
 }
 
-document.querySelector("#panel-close").addEventListener("click", () => {
+function closePanel() {
 	selectedItemId = undefined;
 	panelUpdater = undefined;
 	updateSelectedItems();
 	panel.hidden = true;
-})
+}
+document.querySelector("#panel-close").addEventListener("click", closePanel);
 
 const resizer = document.querySelector("#panel-resizer");
 resizer.addEventListener("mousedown", ev => {
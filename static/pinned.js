@@ -0,0 +1,30 @@
+async function updatePinned() {
+	const pins = await fetchData("/api/pins");
+	const pinTemplate = document.querySelector("#pin-template");
+	document.querySelector(`#body`).replaceChildren(
+		...(pins.length == 0 ? [document.createTextNode("Nothing pinned. Pin a trace, log or metric from its side panel to keep it when resetting.")] : pins.map(pin => {
+			const pinContent = pinTemplate.content.cloneNode(true);
+			const pinNode = pinContent.querySelector(".pin");
+			pinContent.querySelector(".pin-time").innerText = timestamp(pin.time._ts, true);
+			pinContent.querySelector(".pin-kind").innerText = pin.kind;
+			pinContent.querySelector(".pin-service").innerText = pin.service;
+			const nameNode = pinContent.querySelector(".pin-name");
+			if(pin.kind == "trace") {
+				nameNode.innerText = `${pin.name} (${pin.spans} span${pin.spans == 1 ? "" : "s"})`;
+				pinNode.id = `item-span-${pin.id}-${pin.span}`;
+				pinNode.addEventListener("click", () => selectSpan(pin.id, pin.span));
+			} else if(pin.kind == "log") {
+				nameNode.innerText = pin.name;
+				pinNode.id = `item-log-${pin.id}`;
+				pinNode.addEventListener("click", () => selectLog(pin.id));
+			} else {
+				nameNode.innerText = pin.name;
+				pinNode.id = `item-metric-${pin.id}`;
+				pinNode.addEventListener("click", () => selectMetric(pin.id, pin));
+			}
+			pinContent.querySelector(".pin-note").innerText = pin.note ?? "";
+			return pinContent;
+		}))
+	);
+	updateSelectedItems();
+}
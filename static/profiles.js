@@ -0,0 +1,136 @@
+async function updateProfiles() {
+	const profiles = await fetchData("/api/profiles");
+	profiles.sort((p1, p2) => cmp(p1.time._ts, p2.time._ts) || cmp(p1.id, p2.id));
+	const profileTemplate = document.querySelector("#profile-template");
+	document.querySelector(`#body`).replaceChildren(
+		...(profiles.length == 0 ? [document.createTextNode("No profiles.")] : profiles.map(profile => {
+			const profileContent = profileTemplate.content.cloneNode(true);
+			const profileNode = profileContent.querySelector(".profile");
+			profileContent.querySelector(".profile-time").innerText = timestamp(profile.time._ts, true);
+			profileContent.querySelector(".profile-name").innerText = profile.name;
+			profileContent.querySelector(".profile-samples").innerText = `${profile.samples} samples`;
+			profileNode.id = `item-profile-${profile.id}`;
+			profileNode.addEventListener("click", () => {
+				selectProfile(profile.id);
+			});
+			return profileContent;
+		}))
+	);
+	updateSelectedItems();
+}
+
+function buildFlameTree(samples, valueIdx) {
+	const root = { name: "all", total: 0, self: 0, children: new Map(), spans: new Map() };
+	for(const sample of samples) {
+		const value = Number(sample.vals[valueIdx] ?? 0);
+		if(value == 0) continue;
+		let node = root;
+		const visit = node => {
+			node.total += value;
+			if(sample.span) {
+				node.spans.set(`${sample.span._trace}/${sample.span._span}`, sample.span);
+			}
+		};
+		visit(node);
+		for(const frame of sample.stack) {
+			let child = node.children.get(frame);
+			if(!child) {
+				child = { name: frame, total: 0, self: 0, children: new Map(), spans: new Map() };
+				node.children.set(frame, child);
+			}
+			node = child;
+			visit(node);
+		}
+		node.self += value;
+	}
+	return root;
+}
+
+function renderFlamegraph(ctx, samples, sampleTypes, valueIdx) {
+	const flamegraphContent = document.querySelector("#flamegraph-template").content.cloneNode(true);
+	const flamegraphNode = flamegraphContent.querySelector(".flamegraph");
+	const typeSelect = flamegraphNode.querySelector(".flamegraph-type");
+	const framesNode = flamegraphNode.querySelector(".flamegraph-frames");
+	const propsNode = flamegraphNode.querySelector(".flamegraph-frame-props");
+
+	sampleTypes.forEach((vt, i) => {
+		const option = document.createElement("option");
+		option.value = i;
+		option.innerText = vt.unit ? `${vt.type} (${vt.unit})` : vt.type;
+		typeSelect.appendChild(option);
+	});
+	typeSelect.value = valueIdx;
+
+	const render = () => {
+		const unit = sampleTypes[valueIdx]?.unit ?? "";
+		const root = buildFlameTree(samples, valueIdx);
+		const frameNodes = [];
+		let maxDepth = 0;
+		const renderNode = (node, depth, left) => {
+			if(root.total == 0 || node.total / root.total < 0.001) return;
+			maxDepth = Math.max(maxDepth, depth);
+
+			const frameNode = document.createElement("div");
+			frameNode.classList.add("flamegraph-frame");
+			frameNode.innerText = node.name;
+			frameNode.title = `${node.name}\n${node.total} ${unit}`;
+			frameNode.style.left = (left / root.total * 100) + "%";
+			frameNode.style.width = (node.total / root.total * 100) + "%";
+			frameNode.style.top = (depth * 1.4) + "rem";
+			if(node.spans.size > 0) frameNode.classList.add("flamegraph-linked");
+			frameNode.addEventListener("click", () => {
+				for(const el of framesNode.querySelectorAll(".flamegraph-selected")) {
+					el.classList.remove("flamegraph-selected");
+				}
+				frameNode.classList.add("flamegraph-selected");
+				const props = {
+					function: node.name,
+					total: BigInt(node.total),
+					self: BigInt(node.self),
+				};
+				if(unit) props.unit = unit;
+				if(node.spans.size > 0) props.spans = [...node.spans.values()];
+				propsNode.replaceChildren(...renderMap(ctx, props));
+			});
+			frameNodes.push(frameNode);
+
+			const children = [...node.children.values()];
+			children.sort((c1, c2) => cmp(c1.name, c2.name));
+			for(const child of children) {
+				renderNode(child, depth + 1, left);
+				left += child.total;
+			}
+		};
+		renderNode(root, 0, 0);
+		framesNode.style.height = ((maxDepth + 1) * 1.4) + "rem";
+		framesNode.replaceChildren(...frameNodes);
+		propsNode.replaceChildren();
+	};
+	typeSelect.addEventListener("change", () => {
+		valueIdx = Number(typeSelect.value);
+		render();
+	});
+	render();
+
+	return flamegraphNode;
+}
+
+async function selectProfile(profileId) {
+	selectItem(`profile-${profileId}`, `Profile ${profileId}`);
+
+	let data;
+	try {
+		data = await fetchData(`/api/profile/${profileId}`);
+	} catch(err) {
+		setPanelBody([document.createTextNode("Failed to load profile")]);
+		console.error(err);
+		return;
+	}
+
+	const profile = data.profile;
+	const valueIdx = Number(profile["sample.types.default"] ?? 0n);
+	setPanelBody([
+		renderFlamegraph(data, data.samples, profile["sample.types"], valueIdx),
+		...renderMap(data, profile),
+	]);
+}
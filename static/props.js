@@ -77,9 +77,11 @@ function renderProp(ctx, k, v) {
 				inline = trace + " / " + span;
 				const link = document.createElement("a");
 				link.innerText = "[go to span]";
-				link.addEventListener("click", ev => {
-					selectSpan(trace, span);
+				link.addEventListener("click", async ev => {
 					ev.preventDefault();
+					if(!await goToSpan(trace, span)) {
+						link.replaceWith("(not received)");
+					}
 				});
 				children = [link];
 			} else {
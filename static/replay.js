@@ -0,0 +1,78 @@
+function replaySelection(itemId) {
+	if(!itemId) return undefined;
+	let m;
+	if(m = itemId.match(/^span-([0-9a-f]+)-[0-9a-f]+$/)) {
+		return { label: `Trace ${m[1]}`, traces: [m[1]] };
+	} else if(m = itemId.match(/^log-(\d+)$/)) {
+		return { label: `Log ${m[1]}`, logs: [Number(m[1])] };
+	} else if(m = itemId.match(/^metric-([0-9a-f]+)$/)) {
+		return { label: `Metric ${m[1]}`, metrics: [m[1]] };
+	}
+	return undefined;
+}
+
+function parseHeaders(str) {
+	const headers = {};
+	for(const part of str.split(",")) {
+		const idx = part.indexOf("=");
+		if(idx == -1) continue;
+		headers[part.slice(0, idx).trim()] = part.slice(idx+1).trim();
+	}
+	return headers;
+}
+
+let replayTarget = "";
+function openReplay() {
+	const selection = replaySelection(selectedItemId);
+	selectItem("replay", "Replay stored telemetry");
+
+	const form = document.querySelector("#replay-template").content.cloneNode(true).querySelector(".replay");
+	const targetInput = form.querySelector(".replay-target");
+	const selectedRadio = form.querySelector(".replay-selected");
+	const allRadio = form.querySelector(".replay-all");
+	const resultNode = form.querySelector(".replay-result");
+	targetInput.value = replayTarget;
+	if(selection) {
+		form.querySelector(".replay-selected-label").innerText = `Selected: ${selection.label}`;
+		selectedRadio.checked = true;
+	} else {
+		form.querySelector(".replay-selected-label").innerText = "Selected item (select a span, log or metric first)";
+		selectedRadio.disabled = true;
+		allRadio.checked = true;
+	}
+
+	form.addEventListener("submit", async ev => {
+		ev.preventDefault();
+		replayTarget = targetInput.value;
+		const req = {
+			target: targetInput.value,
+			headers: parseHeaders(form.querySelector(".replay-headers").value),
+			now: form.querySelector(".replay-now").checked,
+			newTraceIds: form.querySelector(".replay-new-ids").checked,
+		};
+		if(allRadio.checked) {
+			req.all = true;
+		} else {
+			Object.assign(req, selection);
+			delete req.label;
+		}
+
+		const submit = form.querySelector(".replay-submit");
+		submit.disabled = true;
+		resultNode.classList.remove("replay-error");
+		resultNode.innerText = "Replaying...";
+		try {
+			const res = await fetch("/api/replay", { method: "POST", body: JSON.stringify(req) });
+			if(!res.ok) throw new Error(await res.text());
+			const data = JSON.parse(await res.text());
+			resultNode.innerText = `Sent ${data.requests._int} requests (${data.spans._int} spans, ${data.logs._int} logs, ${data.points._int} points)`;
+		} catch(err) {
+			resultNode.classList.add("replay-error");
+			resultNode.innerText = `Replay failed: ${err.message}`;
+		}
+		submit.disabled = false;
+	});
+	setPanelBody([form]);
+}
+
+document.querySelector("#replay").addEventListener("click", openReplay);
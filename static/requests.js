@@ -0,0 +1,80 @@
+async function updateRequests() {
+	const data = await fetchData("/api/calls");
+	const calls = data.calls;
+	calls.reverse();
+	const requestTemplate = document.querySelector("#request-template");
+	document.querySelector(`#body`).replaceChildren(
+		...(calls.length == 0 ? [document.createTextNode("No requests.")] : calls.map(call => {
+			const req = data.requests[call.req._req] ?? {};
+			const requestContent = requestTemplate.content.cloneNode(true);
+			const requestNode = requestContent.querySelector(".request");
+			requestContent.querySelector(".request-time").innerText = timestamp(call.time._ts, true);
+			requestContent.querySelector(".request-signal").innerText = call.signal;
+			requestContent.querySelector(".request-peer").innerText = `${req.transport} ${req.peer ?? ""}`;
+			requestContent.querySelector(".request-items").innerText = `${call.items} items`;
+			let size = formatSize(call.size);
+			if(call["size.wire"] != call.size) size += ` (${formatSize(call["size.wire"])} on wire)`;
+			requestContent.querySelector(".request-size").innerText = size;
+			requestNode.id = `item-request-${call.id}`;
+			requestNode.addEventListener("click", () => {
+				selectRequest(call.id);
+			});
+			return requestContent;
+		}))
+	);
+	updateSelectedItems();
+}
+
+function hexDump(bytes) {
+	const maxBytes = 16384;
+	const lines = [];
+	for(let off = 0; off < Math.min(bytes.length, maxBytes); off += 16) {
+		const row = bytes.slice(off, off + 16);
+		const hex = [...row].map(b => b.toString(16).padStart(2, "0")).join(" ");
+		const ascii = [...row].map(b => b >= 0x20 && b < 0x7f ? String.fromCharCode(b) : ".").join("");
+		lines.push(off.toString(16).padStart(8, "0") + "  " + hex.padEnd(16*3) + " " + ascii);
+	}
+	if(bytes.length > maxBytes) {
+		lines.push(`[${bytes.length - maxBytes} more bytes]`);
+	}
+	return lines.join("\n");
+}
+
+async function selectRequest(callId) {
+	selectItem(`request-${callId}`, `Request ${callId}`);
+
+	let data;
+	try {
+		data = await fetchData(`/api/call/${callId}`);
+	} catch(err) {
+		setPanelBody([document.createTextNode("Failed to load request")]);
+		console.error(err);
+		return;
+	}
+
+	const children = [];
+	if(data.call["body.kept"]) {
+		const viewerContent = document.querySelector("#payload-template").content.cloneNode(true);
+		const contentNode = viewerContent.querySelector(".payload-content");
+		const showPayload = async (format) => {
+			contentNode.innerText = "Loading...";
+			try {
+				const res = await fetch(`/api/call/${callId}/${format}`);
+				if(!res.ok) throw new Error(`Request returned code ${res.status}`);
+				if(format == "body") {
+					contentNode.innerText = hexDump(new Uint8Array(await res.arrayBuffer()));
+				} else {
+					contentNode.innerText = JSON.stringify(JSON.parse(await res.text()), null, 2);
+				}
+			} catch(err) {
+				contentNode.innerText = "Failed to load payload";
+				console.error(err);
+			}
+		};
+		viewerContent.querySelector(".payload-hex").addEventListener("click", () => showPayload("body"));
+		viewerContent.querySelector(".payload-json").addEventListener("click", () => showPayload("json"));
+		children.push(viewerContent);
+	}
+	children.push(...renderMap(data, data.call));
+	setPanelBody(children);
+}
@@ -10,6 +10,8 @@ async function updateLoop(updater) {
 			try {
 				await updater();
 				await updatePanel();
+				await updateStats();
+				await updateTenants();
 			} catch(err) {
 				console.error("Failed to update UI:", err);
 			}
@@ -49,6 +51,31 @@ const tabs = {
 		title: "Metrics - TelUI",
 		updater: updateMetrics,
 	},
+	"#profiles": {
+		tabId: "profiles-tab",
+		title: "Profiles - TelUI",
+		updater: updateProfiles,
+	},
+	"#requests": {
+		tabId: "requests-tab",
+		title: "Requests - TelUI",
+		updater: updateRequests,
+	},
+	"#clients": {
+		tabId: "clients-tab",
+		title: "Clients - TelUI",
+		updater: updateClients,
+	},
+	"#diagnostics": {
+		tabId: "diagnostics-tab",
+		title: "Diagnostics - TelUI",
+		updater: updateDiagnostics,
+	},
+	"#pinned": {
+		tabId: "pinned-tab",
+		title: "Pinned - TelUI",
+		updater: updatePinned,
+	},
 }
 const body = document.querySelector(`#body`);
 let updatingTab = false;
@@ -85,4 +112,55 @@ resetButton.addEventListener("click", async () => {
 		console.error(er);
 	}
 	resetButton.disabled = false;
-});
\ No newline at end of file
+});
+const generateCheckbox = document.querySelector("#generate");
+generateCheckbox.addEventListener("change", async () => {
+	generateCheckbox.disabled = true;
+	try {
+		await fetch(`/api/generate?running=${generateCheckbox.checked}`, { method: "POST" });
+	} catch(err) {
+		console.error(err);
+	}
+	generateCheckbox.disabled = false;
+});
+addEventListener("load", async () => {
+	try {
+		const data = await fetchData("/api/generate");
+		generateCheckbox.checked = data.running;
+		generateCheckbox.title = `${data.rate} traces per second` + (data.tenant ? ` for tenant ${data.tenant}` : "");
+	} catch(err) {
+		console.error(err);
+	}
+});
+
+const tenantSelect = document.querySelector("#tenant");
+function selectedTenant() {
+	const cookie = document.cookie.split("; ").find(c => c.startsWith("telui-tenant="));
+	return cookie ? decodeURIComponent(cookie.slice("telui-tenant=".length)) : "";
+}
+function selectTenant(name) {
+	document.cookie = `telui-tenant=${encodeURIComponent(name)}; path=/; SameSite=Strict`;
+}
+async function updateTenants() {
+	const data = await fetchData("/api/tenants");
+	if(!data.header) return;
+	const names = ["", ...data.tenants];
+	if(!names.includes(selectedTenant())) selectTenant("");
+	if(tenantSelect.options.length != names.length) {
+		tenantSelect.replaceChildren(...names.map(name => {
+			const option = document.createElement("option");
+			option.value = name;
+			option.innerText = name || "(default)";
+			return option;
+		}));
+	}
+	tenantSelect.value = selectedTenant();
+	tenantSelect.title = `Tenant, by the ${data.header} header`;
+	resetButton.title = "Forget the telemetry of this tenant";
+	tenantSelect.hidden = false;
+}
+tenantSelect.addEventListener("change", () => {
+	selectTenant(tenantSelect.value);
+	closePanel();
+	updateTab();
+});
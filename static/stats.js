@@ -0,0 +1,52 @@
+const statsNode = document.querySelector("#stats");
+const signalUnits = {
+	traces: "spans",
+	logs: "logs",
+	metrics: "points",
+	profiles: "samples",
+};
+
+function formatRate(n, window) {
+	const rate = Number(n) / window;
+	return rate >= 10 || rate == 0 ? rate.toFixed(0) : rate.toFixed(1);
+}
+
+async function updateStats() {
+	const stats = await fetchData("/api/stats");
+	const window = Number(stats.window);
+
+	let requests = 0n, bytes = 0n;
+	const parts = [];
+	for(const [signal, s] of sortedEntries(stats.signals)) {
+		requests += s.recent.requests;
+		bytes += s.recent.bytes;
+		parts.push(`${formatRate(s.recent.items[signal] ?? 0, window)} ${signalUnits[signal] ?? signal}/s`);
+	}
+	parts.push(`${formatRate(requests, window)} req/s`);
+	parts.push(`${formatSize(Math.round(Number(bytes) / window))}/s`);
+	const sampling = stats.sampling;
+	let kept = 0n, dropped = 0n;
+	if(sampling) {
+		kept = Object.values(sampling.kept).reduce((a, b) => a + b, 0n);
+		dropped = Object.values(sampling.dropped).reduce((a, b) => a + b, 0n);
+		if(kept + dropped > 0n) parts.push(`${(Number(kept) / Number(kept + dropped) * 100).toFixed(0)}% of traces kept`);
+	}
+	statsNode.innerText = parts.join(" · ");
+
+	const now = BigInt(Date.now()) * 1000000n;
+	const lines = [`Rates over the last ${window} s`, ""];
+	for(const [service, s] of sortedEntries(stats.services)) {
+		const items = Object.entries(s.recent.items)
+			.map(([signal, n]) => `${formatRate(n, window)} ${signalUnits[signal] ?? signal}/s`);
+		const idle = Number((now - s.last._ts) / 1000000000n);
+		let line = `${service}: ${items.length > 0 ? items.join(", ") : "idle"}`;
+		if(idle >= window) line += ` (last seen ${idle} s ago)`;
+		lines.push(line);
+	}
+	if(sampling) {
+		lines.push("", `Sampling: ${kept} traces kept, ${dropped} dropped, ${sampling.pending} waiting for a tail decision`);
+		for(const [reason, n] of sortedEntries(sampling.kept)) lines.push(`kept by ${reason}: ${n}`);
+		for(const [reason, n] of sortedEntries(sampling.dropped)) lines.push(`dropped by ${reason}: ${n}`);
+	}
+	statsNode.title = lines.join("\n");
+}
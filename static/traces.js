@@ -66,5 +66,60 @@ async function selectSpan(traceId, spanId) {
 		return;
 	}
 	data.traceId = traceId;
-	setPanelBody(renderMap(data, data.span));
+	setPanelActions(
+		pinAction("trace", traceId, data.pin),
+		deleteAction("Delete trace", `/api/trace/${traceId}`),
+		resourceDeletion(data.span.res._res, data.resource),
+	);
+	const children = renderMap(data, data.span);
+	if(data["trace.logs"] > 0) {
+		const logsNode = renderLogList(`Logs of this span (${data.logs.length})`, data.logs, false);
+		if(data["trace.logs"] > data.logs.length) {
+			const link = document.createElement("a");
+			link.innerText = `[all ${data["trace.logs"]} logs of the trace]`;
+			link.addEventListener("click", () => selectTraceLogs(traceId));
+			logsNode.querySelector(".log-list-title").append(" ", link);
+		}
+		children.push(logsNode);
+	}
+	setPanelBody(children);
+}
+
+async function selectTraceLogs(traceId) {
+	selectItem(`trace-logs-${traceId}`, `Trace ${traceId} | Logs`);
+
+	let logs;
+	try {
+		logs = await fetchData(`/api/trace/${traceId}/logs`);
+	} catch(err) {
+		setPanelBody([document.createTextNode("Failed to load logs")]);
+		console.error(err);
+		return;
+	}
+	setPanelBody([renderLogList(`Logs of this trace (${logs.length})`, logs, true)]);
+}
+
+function renderLogList(title, logs, showSpans) {
+	const listNode = document.createElement("div");
+	listNode.classList.add("log-list");
+	const titleNode = document.createElement("div");
+	titleNode.classList.add("log-list-title");
+	titleNode.innerText = title;
+	logs.sort((l1, l2) => cmp(l1.time._ts, l2.time._ts));
+	listNode.append(titleNode, ...logs.map(log => renderLogLine(log, showSpans)));
+	return listNode;
+}
+
+// Shows the span in the traces tab, or returns false if it was not received
+async function goToSpan(traceId, spanId) {
+	try {
+		await fetchData(`/api/span/${traceId}/${spanId}`);
+	} catch(err) {
+		if(err.statusCode == 404) return false;
+		throw err;
+	}
+	scrollToSelected = true;
+	location.hash = "#traces";
+	selectSpan(traceId, spanId);
+	return true;
 }
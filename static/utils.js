@@ -33,6 +33,12 @@ function timestamp(t, short) {
 	const ns = String(t%1000000n).padStart(6,"0");
 	return ms + " " + ns.slice(0,3) + " " + ns.slice(3) + " UTC"
 }
+function formatSize(n) {
+	n = Number(n);
+	if(n < 1024) return `${n} B`;
+	if(n < 1024*1024) return `${(n/1024).toFixed(1)} KiB`;
+	return `${(n/1024/1024).toFixed(1)} MiB`;
+}
 
 async function fetchData(url) {
 	const res = await fetch(url);
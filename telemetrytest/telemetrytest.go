@@ -0,0 +1,85 @@
+// Package telemetrytest runs telui's OTLP receivers in-process, on ephemeral
+// ports, to check the telemetry emitted by the code under test.
+package telemetrytest
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+
+	"github.com/jade-guiton/telui/server"
+)
+
+// Harness is a server.Receiver which stops when the test ends.
+type Harness struct {
+	*server.Receiver
+}
+
+// New starts the receivers with the default settings.
+func New(tb testing.TB) *Harness {
+	tb.Helper()
+	return NewWithConfig(tb, server.DefaultConfig())
+}
+
+// NewWithConfig starts the receivers with the redaction and sampling settings
+// of cfg. Its ports are ignored, and ephemeral ones are used instead. Status
+// messages are discarded unless cfg.Messages is set.
+func NewWithConfig(tb testing.TB, cfg server.Config) *Harness {
+	tb.Helper()
+	cfg.GrpcPort, cfg.HttpPort = 0, 0
+	if cfg.Messages == nil {
+		cfg.Messages = io.Discard
+	}
+	r, err := server.StartReceiver(cfg)
+	if err != nil {
+		tb.Fatalf("failed to start telui receivers: %v", err)
+	}
+	tb.Cleanup(r.Stop)
+	return &Harness{r}
+}
+
+// RequireSpan is like WaitForSpan, but fails the test after the timeout.
+func (h *Harness) RequireSpan(tb testing.TB, timeout time.Duration, ms ...server.Matcher) server.Span {
+	tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	s, err := h.WaitForSpan(ctx, ms...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return s
+}
+
+// RequireLogs is like WaitForLogs, but fails the test after the timeout.
+func (h *Harness) RequireLogs(tb testing.TB, timeout time.Duration, n int, ms ...server.Matcher) []server.Log {
+	tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	logs, err := h.WaitForLogs(ctx, n, ms...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return logs
+}
+
+// RequireMetric is like WaitForMetric, but fails the test after the timeout.
+func (h *Harness) RequireMetric(tb testing.TB, timeout time.Duration, name string, ms ...server.Matcher) server.MetricPoint {
+	tb.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	mp, err := h.WaitForMetric(ctx, name, ms...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return mp
+}
+
+// RequireGolden fails the test if the snapshot of the received telemetry
+// differs from the golden file, or rewrites the file with update.
+func (h *Harness) RequireGolden(tb testing.TB, path string, update bool, ignoreAttrs ...string) {
+	tb.Helper()
+	if err := h.CompareGolden(path, update, ignoreAttrs...); err != nil {
+		tb.Fatal(err)
+	}
+}
@@ -0,0 +1,141 @@
+package telemetrytest
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/jade-guiton/telui/server"
+	"go.opentelemetry.io/collector/pdata/pcommon"
+	"go.opentelemetry.io/collector/pdata/ptrace"
+	"go.opentelemetry.io/collector/pdata/ptrace/ptraceotlp"
+)
+
+const timeout = 5 * time.Second
+
+func post(t *testing.T, url string, body []byte) {
+	t.Helper()
+	res, err := http.Post(url, "application/x-protobuf", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("export returned %s", res.Status)
+	}
+}
+
+func sendTraces(t *testing.T, h *Harness, td ptrace.Traces) {
+	t.Helper()
+	body, err := ptraceotlp.NewExportRequestFromTraces(td).MarshalProto()
+	if err != nil {
+		t.Fatal(err)
+	}
+	post(t, h.HttpEndpoint+"/v1/traces", body)
+}
+
+func traceId(b byte, last byte) pcommon.TraceID {
+	return pcommon.TraceID{b, 1, 2, 3, 4, 5, 6, 7, last, last, last, last, last, last, last, last}
+}
+
+// A trace of a server span with a client child
+func checkoutTrace(tid pcommon.TraceID, start time.Time, pid int64, status ptrace.StatusCode) ptrace.Traces {
+	td := ptrace.NewTraces()
+	rs := td.ResourceSpans().AppendEmpty()
+	rs.Resource().Attributes().PutStr("service.name", "checkout")
+	rs.Resource().Attributes().PutInt("process.pid", pid)
+	ss := rs.ScopeSpans().AppendEmpty()
+	ss.Scope().SetName("test")
+
+	root := ss.Spans().AppendEmpty()
+	root.SetTraceID(tid)
+	root.SetSpanID(pcommon.SpanID{tid[0], 1})
+	root.SetName("POST /checkout")
+	root.SetKind(ptrace.SpanKindServer)
+	root.SetStartTimestamp(pcommon.NewTimestampFromTime(start))
+	root.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(30 * time.Millisecond)))
+	root.Status().SetCode(status)
+	root.Attributes().PutInt("http.response.status_code", 200)
+
+	child := ss.Spans().AppendEmpty()
+	child.SetTraceID(tid)
+	child.SetSpanID(pcommon.SpanID{tid[0], 2})
+	child.SetParentSpanID(root.SpanID())
+	child.SetName("Charge")
+	child.SetKind(ptrace.SpanKindClient)
+	child.SetStartTimestamp(pcommon.NewTimestampFromTime(start.Add(5 * time.Millisecond)))
+	child.SetEndTimestamp(pcommon.NewTimestampFromTime(start.Add(20 * time.Millisecond)))
+	return td
+}
+
+func TestRequireSpan(t *testing.T) {
+	h := New(t)
+	tid := traceId(1, 0)
+	sendTraces(t, h, checkoutTrace(tid, time.Now(), 100, ptrace.StatusCodeError))
+	s := h.RequireSpan(t, timeout, server.Named("POST /checkout"), server.ResourceAttr("process.pid", 100))
+	if s.TraceID != tid.String() || s.Status != "Error" {
+		t.Errorf("got span of trace %s with status %q, want trace %s with status Error", s.TraceID, s.Status, tid)
+	}
+	if n := len(h.Spans(server.Named("Charge"))); n != 1 {
+		t.Errorf("got %d Charge spans, want 1", n)
+	}
+	h.Reset()
+	if n := len(h.Spans()); n != 0 {
+		t.Errorf("got %d spans after reset, want none", n)
+	}
+}
+
+func TestSnapshotNormalization(t *testing.T) {
+	h1 := New(t)
+	sendTraces(t, h1, checkoutTrace(traceId(1, 0), time.Now(), 100, ptrace.StatusCodeOk))
+	h1.RequireSpan(t, timeout, server.Named("Charge"))
+
+	h2 := New(t)
+	sendTraces(t, h2, checkoutTrace(traceId(2, 0), time.Now().Add(time.Hour), 200, ptrace.StatusCodeOk))
+	h2.RequireSpan(t, timeout, server.Named("Charge"))
+
+	snap1 := h1.Snapshot("process.pid")
+	snap2 := h2.Snapshot("process.pid")
+	if !bytes.Equal(snap1, snap2) {
+		t.Fatalf("snapshots differ:\n%s\n%s", snap1, snap2)
+	}
+	for _, unstable := range []string{"process.pid", traceId(1, 0).String(), "_ts"} {
+		if bytes.Contains(snap1, []byte(unstable)) {
+			t.Errorf("snapshot contains %q:\n%s", unstable, snap1)
+		}
+	}
+	if !bytes.Contains(snap1, []byte(`"children"`)) {
+		t.Errorf("child span is not nested under its parent:\n%s", snap1)
+	}
+	if bytes.Equal(h1.Snapshot(), h2.Snapshot()) {
+		t.Error("snapshots are equal without ignoring process.pid")
+	}
+
+	golden := t.TempDir() + "/golden.json"
+	h1.RequireGolden(t, golden, true, "process.pid")
+	h2.RequireGolden(t, golden, false, "process.pid")
+}
+
+func TestSnapshotParentCycles(t *testing.T) {
+	h := New(t)
+	td := ptrace.NewTraces()
+	spans := td.ResourceSpans().AppendEmpty().ScopeSpans().AppendEmpty().Spans()
+	// Self-parented, a cycle of two spans, and a child of the cycle
+	for _, sp := range [][3]byte{{1, 1, 'A'}, {2, 3, 'B'}, {3, 2, 'C'}, {4, 2, 'D'}} {
+		s := spans.AppendEmpty()
+		s.SetTraceID(traceId(1, 0))
+		s.SetSpanID(pcommon.SpanID{sp[0]})
+		s.SetParentSpanID(pcommon.SpanID{sp[1]})
+		s.SetName("span " + string(sp[2]))
+	}
+	sendTraces(t, h, td)
+	h.RequireSpan(t, timeout, server.Named("span D"))
+
+	snap := h.Snapshot()
+	for _, name := range []string{"span A", "span B", "span C", "span D"} {
+		if n := bytes.Count(snap, []byte(`"`+name+`"`)); n != 1 {
+			t.Errorf("%s appears %d times in the snapshot:\n%s", name, n, snap)
+		}
+	}
+}